@@ -9,35 +9,45 @@
 package crb
 
 import (
+	"bytes"
 	"crypto/md5"
+	"crypto/rand"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"runtime"
+	"sort"
 	"strconv"
 	"time"
 	"unicode/utf16"
 )
 
 type Bookmarks struct {
-	Checksum string `json:"checksum"`
-	Roots    struct {
-		BookmarkBar    BookmarkNode `json:"bookmark_bar"`
-		Other          BookmarkNode `json:"other"`
-		MobileBookmark BookmarkNode `json:"synced"`
-	} `json:"roots"`
+	Checksum         string            `json:"checksum"`
+	Roots            Roots             `json:"roots"`
 	SyncMetadata     Bytes             `json:"sync_metadata,omitempty"`
 	Version          Version           `json:"version"`
 	MetaInfo         map[string]string `json:"meta_info,omitempty"`
 	UnsyncedMetaInfo map[string]string `json:"unsynced_meta_info,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"` // unrecognized fields
+}
+
+type Roots struct {
+	BookmarkBar    BookmarkNode `json:"bookmark_bar"`
+	Other          BookmarkNode `json:"other"`
+	MobileBookmark BookmarkNode `json:"synced"`
+
+	Extra map[string]json.RawMessage `json:"-"` // unrecognized fields
 }
 
 type BookmarkNode struct {
 	Children         *[]BookmarkNode   `json:"children,omitempty"` // Type == NodeTypeFolder
 	DateAdded        Time              `json:"date_added"`
-	DateLastUsed     Time              `json:"date_last_used,omitempty"`
+	DateLastUsed     Time              `json:"date_last_used"`
 	DateModified     Time              `json:"date_modified,omitempty"`
 	GUID             GUID              `json:"guid"`
 	ID               int               `json:"id,string"`
@@ -48,29 +58,360 @@ type BookmarkNode struct {
 	URL              string            `json:"url,omitempty"`
 	MetaInfo         map[string]string `json:"meta_info,omitempty"`
 	UnsyncedMetaInfo map[string]string `json:"unsynced_meta_info,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"` // unrecognized fields
+}
+
+var (
+	_ json.Marshaler   = Bookmarks{}
+	_ json.Unmarshaler = (*Bookmarks)(nil)
+	_ json.Marshaler   = Roots{}
+	_ json.Unmarshaler = (*Roots)(nil)
+	_ json.Marshaler   = BookmarkNode{}
+	_ json.Unmarshaler = (*BookmarkNode)(nil)
+)
+
+func (b Bookmarks) MarshalJSON() ([]byte, error) {
+	type bookmarks Bookmarks
+	return marshalExtra(bookmarks(b), b.Extra)
+}
+
+func (b *Bookmarks) UnmarshalJSON(buf []byte) error {
+	return b.decode(json.NewDecoder(bytes.NewReader(buf)))
+}
+
+func (b *Bookmarks) decode(d *json.Decoder) error {
+	return decodeObject(d, &b.Extra, func(k string) any {
+		switch k {
+		case "checksum":
+			return &b.Checksum
+		case "roots":
+			return b.Roots.decode
+		case "sync_metadata":
+			return &b.SyncMetadata
+		case "version":
+			return &b.Version
+		case "meta_info":
+			return &b.MetaInfo
+		case "unsynced_meta_info":
+			return &b.UnsyncedMetaInfo
+		}
+		return nil
+	})
+}
+
+func (r Roots) MarshalJSON() ([]byte, error) {
+	type roots Roots
+	return marshalExtra(roots(r), r.Extra)
+}
+
+func (r *Roots) UnmarshalJSON(buf []byte) error {
+	return r.decode(json.NewDecoder(bytes.NewReader(buf)))
+}
+
+func (r *Roots) decode(d *json.Decoder) error {
+	return decodeObject(d, &r.Extra, func(k string) any {
+		switch k {
+		case "bookmark_bar":
+			return r.BookmarkBar.decode
+		case "other":
+			return r.Other.decode
+		case "synced":
+			return r.MobileBookmark.decode
+		}
+		return nil
+	})
+}
+
+func (n BookmarkNode) MarshalJSON() ([]byte, error) {
+	type bookmarkNode BookmarkNode
+	extra := n.Extra
+	if n.Type == NodeTypeFolder && (n.Children == nil || n.DateModified.IsZero()) {
+		// Chrome always writes these for folders
+		extra = make(map[string]json.RawMessage, len(n.Extra)+2)
+		for k, v := range n.Extra {
+			extra[k] = v
+		}
+		if n.Children == nil {
+			extra["children"] = json.RawMessage(`[]`)
+		}
+		if n.DateModified.IsZero() {
+			extra["date_modified"] = json.RawMessage(`"0"`)
+		}
+	}
+	if n.Type == NodeTypeURL && n.URL == "" {
+		// Chrome always writes this for urls
+		extra = make(map[string]json.RawMessage, len(n.Extra)+1)
+		for k, v := range n.Extra {
+			extra[k] = v
+		}
+		extra["url"] = json.RawMessage(`""`)
+	}
+	return marshalExtra(bookmarkNode(n), extra)
+}
+
+func (n *BookmarkNode) UnmarshalJSON(buf []byte) error {
+	return n.decode(json.NewDecoder(bytes.NewReader(buf)))
+}
+
+func (n *BookmarkNode) decode(d *json.Decoder) error {
+	return decodeObject(d, &n.Extra, func(k string) any {
+		switch k {
+		case "children":
+			return n.decodeChildren
+		case "date_added":
+			return &n.DateAdded
+		case "date_last_used":
+			return &n.DateLastUsed
+		case "date_modified":
+			return &n.DateModified
+		case "guid":
+			return &n.GUID
+		case "id":
+			return n.decodeID
+		case "name":
+			return &n.Name
+		case "show_icon":
+			return &n.ShowIcon
+		case "source":
+			return &n.Source
+		case "type":
+			return &n.Type
+		case "url":
+			return &n.URL
+		case "meta_info":
+			return &n.MetaInfo
+		case "unsynced_meta_info":
+			return &n.UnsyncedMetaInfo
+		}
+		return nil
+	})
+}
+
+func (n *BookmarkNode) decodeChildren(d *json.Decoder) error {
+	t, err := d.Token()
+	if err != nil {
+		return err
+	}
+	switch t {
+	case nil:
+		n.Children = nil
+		return nil
+	case json.Delim('['):
+	default:
+		return fmt.Errorf("expected array, got %v", t)
+	}
+	cs := []BookmarkNode{}
+	for d.More() {
+		cs = append(cs, BookmarkNode{})
+		if err := cs[len(cs)-1].decode(d); err != nil {
+			return err
+		}
+	}
+	if _, err := d.Token(); err != nil {
+		return err
+	}
+	n.Children = &cs
+	return nil
+}
+
+func (n *BookmarkNode) decodeID(d *json.Decoder) error {
+	var s string
+	if err := d.Decode(&s); err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", s)
+	}
+	n.ID = id
+	return nil
+}
+
+// marshalExtra marshals the struct v, adding the members from extra after the
+// known ones in sorted order.
+func marshalExtra(v interface{}, extra map[string]json.RawMessage) ([]byte, error) {
+	buf, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return buf, err
+	}
+	keys := make([]string, 0, len(extra))
+	for k := range extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf = buf[:len(buf)-1] // }
+	for _, k := range keys {
+		if len(buf) > 1 {
+			buf = append(buf, ',')
+		}
+		kb, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, kb...)
+		buf = append(buf, ':')
+		if v := extra[k]; len(v) == 0 {
+			buf = append(buf, "null"...)
+		} else {
+			buf = append(buf, v...)
+		}
+	}
+	return append(buf, '}'), nil
+}
+
+// decodeObject decodes an object from d in a single pass, setting extra to the
+// members which field doesn't recognize. The keys are matched exactly (unlike
+// encoding/json), and field returns a pointer to decode the value into, a func
+// to decode it with, or nil if the key is unknown. A null is ignored.
+func decodeObject(d *json.Decoder, extra *map[string]json.RawMessage, field func(k string) any) error {
+	t, err := d.Token()
+	if err != nil {
+		return err
+	}
+	switch t {
+	case nil:
+		return nil
+	case json.Delim('{'):
+	default:
+		return fmt.Errorf("expected object, got %v", t)
+	}
+	var obj map[string]json.RawMessage
+	for d.More() {
+		t, err := d.Token()
+		if err != nil {
+			return err
+		}
+		k := t.(string)
+		switch v := field(k).(type) {
+		case nil:
+			var raw json.RawMessage
+			if err := d.Decode(&raw); err != nil {
+				return err
+			}
+			if obj == nil {
+				obj = map[string]json.RawMessage{}
+			}
+			obj[k] = raw
+		case func(*json.Decoder) error:
+			if err := v(d); err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+		default:
+			if err := d.Decode(v); err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+		}
+	}
+	if _, err := d.Token(); err != nil {
+		return err
+	}
+	*extra = obj
+	return nil
 }
 
 // Decode strictly decodes a Chrome bookmarks file.
 func Decode(r io.Reader) (*Bookmarks, bool, error) {
-	var b Bookmarks
-	d := json.NewDecoder(r)
-	d.DisallowUnknownFields()
-	if err := d.Decode(&b); err != nil {
+	b, valid, unk, err := DecodeLenient(r)
+	if err != nil {
 		return nil, false, err
 	}
-	return &b, b.Checksum == b.CalculateChecksum(), nil
+	if len(unk) != 0 {
+		return nil, false, fmt.Errorf("unknown field %q", unk[0].Path)
+	}
+	return b, valid, nil
+}
+
+// DecodeLenient is like Decode, but it returns unknown fields rather than
+// failing. The unknown fields are preserved in the Extra maps, but their
+// original order isn't: MarshalJSON writes them after the known fields in
+// sorted order, and Encode sorts all keys like Chrome does.
+func DecodeLenient(r io.Reader) (*Bookmarks, bool, []UnknownField, error) {
+	var b Bookmarks
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return nil, false, nil, err
+	}
+	return &b, b.Checksum == b.CalculateChecksum(), b.UnknownFields(), nil
+}
+
+// UnknownField is an object member in a Chrome bookmarks file which isn't
+// recognized by crb.
+type UnknownField struct {
+	Path   string // e.g., roots.bookmark_bar.children[2].example
+	NodeID int    // the nearest node containing the field, or 0 if none
+}
+
+func (f UnknownField) String() string {
+	if f.NodeID != 0 {
+		return fmt.Sprintf("%s (node %d)", f.Path, f.NodeID)
+	}
+	return f.Path
+}
+
+// UnknownFields returns the unrecognized fields stored in the Extra maps of b.
+func (b Bookmarks) UnknownFields() []UnknownField {
+	var unk []UnknownField
+	unknownFields(&unk, b.Extra, "", 0)
+	unknownFields(&unk, b.Roots.Extra, "roots", 0)
+	b.Roots.BookmarkBar.unknownFields(&unk, "roots.bookmark_bar")
+	b.Roots.Other.unknownFields(&unk, "roots.other")
+	b.Roots.MobileBookmark.unknownFields(&unk, "roots.synced")
+	return unk
 }
 
-// Encode re-encodes a Chrome bookmarks file. It should be more or less the same
-// as Chrome itself, but the formatting is slightly different.
+func (n BookmarkNode) unknownFields(unk *[]UnknownField, path string) {
+	unknownFields(unk, n.Extra, path, n.ID)
+	if n.Children != nil {
+		for i, c := range *n.Children {
+			c.unknownFields(unk, path+".children["+strconv.Itoa(i)+"]")
+		}
+	}
+}
+
+func unknownFields(unk *[]UnknownField, extra map[string]json.RawMessage, path string, id int) {
+	keys := make([]string, 0, len(extra))
+	for k := range extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if path != "" {
+			k = path + "." + k
+		}
+		*unk = append(*unk, UnknownField{Path: k, NodeID: id})
+	}
+}
+
+// Encode re-encodes a Chrome bookmarks file. The output should be identical to
+// what Chrome would write on the current platform.
 func Encode(w io.Writer, b *Bookmarks) error {
-	e := json.NewEncoder(w)
-	e.SetIndent("", "   ")
-	e.SetEscapeHTML(false)
-	return e.Encode(b)
+	return EncodeOptions{
+		CRLF: runtime.GOOS == "windows",
+	}.Encode(w, b)
 }
 
-// Calculate calculates the expected checksum for b.
+// EncodeOptions contains options for encoding a Chrome bookmarks file.
+type EncodeOptions struct {
+	CRLF           bool // use Windows line endings
+	UpdateChecksum bool // write the correct checksum rather than b.Checksum
+}
+
+// Encode re-encodes a Chrome bookmarks file.
+func (o EncodeOptions) Encode(w io.Writer, b *Bookmarks) error {
+	if o.UpdateChecksum {
+		c := *b
+		c.UpdateChecksum()
+		b = &c
+	}
+	buf, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	return reformatJSON(w, buf, o.CRLF)
+}
+
+// CalculateChecksum calculates the expected checksum for b.
 func (b Bookmarks) CalculateChecksum() string {
 	h := md5.New()
 	b.Walk(func(n BookmarkNode, parents ...string) error {
@@ -90,33 +431,30 @@ func (b Bookmarks) CalculateChecksum() string {
 	return hex.EncodeToString(h.Sum(nil))
 }
 
+// UpdateChecksum sets the checksum of b to the expected value, which is
+// required for Chrome to load the file without reassigning IDs.
+func (b *Bookmarks) UpdateChecksum() {
+	b.Checksum = b.CalculateChecksum()
+}
+
 var ErrBreak = errors.New("break")
 
 type WalkFunc func(n BookmarkNode, parents ...string) error
 
 // Walk iterates over folders and bookmarks in b depth-first, stopping if
-// ErrBreak or another error is returned.
+// ErrBreak or another error is returned. The parents do not include the
+// permanent folder.
 func (b Bookmarks) Walk(fn WalkFunc) error {
 	if fn == nil {
 		return nil
 	}
-	if err := b.Roots.BookmarkBar.walk(fn); err != nil {
-		if err == ErrBreak {
-			err = nil
-		}
-		return err
-	}
-	if err := b.Roots.Other.walk(fn); err != nil {
-		if err == ErrBreak {
-			err = nil
-		}
-		return err
-	}
-	if err := b.Roots.MobileBookmark.walk(fn); err != nil {
-		if err == ErrBreak {
-			err = nil
+	for path, n := range b.All() {
+		if err := fn(*n, path[1:]...); err != nil {
+			if err == ErrBreak {
+				err = nil
+			}
+			return err
 		}
-		return err
 	}
 	return nil
 }
@@ -127,21 +465,18 @@ func (n BookmarkNode) Walk(fn WalkFunc) error {
 	if fn == nil {
 		return nil
 	}
-	if err := n.walk(fn); err != nil && err != ErrBreak {
-		return err
-	}
-	return nil
-}
-
-func (n BookmarkNode) walk(fn WalkFunc, parents ...string) error {
-	if err := fn(n, parents...); err != nil {
+	if err := fn(n); err != nil {
+		if err == ErrBreak {
+			err = nil
+		}
 		return err
 	}
-	if n.Type == NodeTypeFolder && n.Children != nil {
-		for _, c := range *n.Children {
-			if err := c.walk(fn, append(parents, c.Name)...); err != nil {
-				return err
+	for path, c := range n.Descendants() {
+		if err := fn(*c, path...); err != nil {
+			if err == ErrBreak {
+				err = nil
 			}
+			return err
 		}
 	}
 	return nil
@@ -309,9 +644,6 @@ func (t Time) IsZero() bool {
 }
 
 func (t Time) MarshalJSON() ([]byte, error) {
-	if t.IsZero() {
-		return nil, nil
-	}
 	return json.Marshal(strconv.FormatInt(int64(t), 10))
 }
 
@@ -376,11 +708,43 @@ func (s *GUID) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// GUIDs of the permanent nodes, from bookmark_node.cc.
+const (
+	RootNodeGUID        GUID = "00000000-0000-4000-a000-000000000001" // not stored in the file
+	BookmarkBarGUID     GUID = "0bc5d13f-2cba-5d74-951f-3f233fe6c908"
+	OtherBookmarksGUID  GUID = "82b081ec-3dd3-529c-8475-ab6c344590dd"
+	MobileBookmarksGUID GUID = "4cf2e351-0e85-532b-bb37-df045d8f8d0f"
+)
+
+// NewGUID generates a random (version 4) GUID in lowercase canonical form.
+func NewGUID() GUID {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		panic(err)
+	}
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+	return GUID(fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]))
+}
+
 func (s GUID) String() string {
 	v, _ := s.Canonical()
 	return v
 }
 
+// Equal returns true if s and t are valid and equal, ignoring case.
+func (s GUID) Equal(t GUID) bool {
+	a, err := s.Bytes()
+	if err != nil {
+		return false
+	}
+	b, err := t.Bytes()
+	if err != nil {
+		return false
+	}
+	return a == b
+}
+
 func (s GUID) Valid() error {
 	_, err := s.Bytes()
 	return err
@@ -0,0 +1,288 @@
+package crb
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeGolden(t *testing.T) {
+	b := codecTestBookmarks()
+	if c := b.CalculateChecksum(); c != b.Checksum {
+		t.Errorf("checksum: got %s, expected %s", c, b.Checksum)
+	}
+	for _, tc := range []struct {
+		out  string
+		crlf bool
+	}{
+		{"Bookmarks", false},
+		{"Bookmarks.crlf", true},
+	} {
+		t.Run(tc.out, func(t *testing.T) {
+			exp, err := os.ReadFile(filepath.Join("testdata", tc.out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := (EncodeOptions{CRLF: tc.crlf}).Encode(&buf, b); err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			if act := buf.Bytes(); !bytes.Equal(act, exp) {
+				t.Errorf("encode: output differs from %s:\n%s", tc.out, act)
+			}
+		})
+	}
+}
+
+func TestDecodeGolden(t *testing.T) {
+	exp := codecTestBookmarks()
+	for _, in := range []string{"Bookmarks", "Bookmarks.crlf"} {
+		t.Run(in, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			b, valid, unk, err := DecodeLenient(f)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if !valid {
+				t.Errorf("decode: checksum mismatch")
+			}
+			if len(unk) != 2 {
+				t.Errorf("decode: expected 2 unknown fields, got %v", unk)
+			}
+			if !reflect.DeepEqual(b, exp) {
+				t.Errorf("decode: got %+v, expected %+v", b, exp)
+			}
+		})
+	}
+}
+
+func TestEncodeFormat(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "Bookmarks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	b, _, _, err := DecodeLenient(f)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := (EncodeOptions{}).Encode(&buf, b); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	out := buf.String()
+
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		if n := len(line) - len(strings.TrimLeft(line, " ")); n%3 != 0 {
+			t.Errorf("line not indented by a multiple of 3 spaces: %q", line)
+		}
+	}
+	for _, s := range []string{
+		`"children": [  ],`,
+		`"children": [ {`,
+		`}, {`,
+		`"name": "Example \u003Cb>Bold\u003C/b> & \"Quoted\"",`,
+		`"url": "https://example.com/?q=%3Cscript%3E&a=1"`,
+		`"name": "Jira – Board ✓",`,
+		`"name": "Work\tStuff",`,
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("output does not contain %q", s)
+		}
+	}
+	if strings.Contains(out, "<") {
+		t.Errorf("output contains an unescaped <")
+	}
+	if strings.Contains(out, "\r") {
+		t.Errorf("output contains CR without CRLF set")
+	}
+
+	// extra fields are sorted along with the known ones like Chrome does
+	for _, keys := range [][]string{
+		{`"roots"`, `"sync_metadata"`, `"sync_transaction_version": "12"`, `"version"`},
+		{`"name": "Jira`, `"sync_transaction_version": "3"`, `"type": "url"`},
+	} {
+		rest := out
+		for _, k := range keys {
+			i := strings.Index(rest, k)
+			if i == -1 {
+				t.Errorf("output does not contain %s after the previous key", k)
+				break
+			}
+			rest = rest[i+len(k):]
+		}
+	}
+}
+
+func TestEncodeUpdateChecksum(t *testing.T) {
+	b := codecTestBookmarks()
+	b.Roots.Other.Name = "Renamed"
+
+	for _, update := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := (EncodeOptions{UpdateChecksum: update}).Encode(&buf, b); err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		if _, valid, _, err := DecodeLenient(&buf); err != nil {
+			t.Fatalf("decode: %v", err)
+		} else if valid != update {
+			t.Errorf("UpdateChecksum=%t: expected valid=%t", update, update)
+		}
+	}
+	if b.Checksum != codecTestBookmarks().Checksum {
+		t.Errorf("UpdateChecksum modified the original checksum")
+	}
+}
+
+func TestDecodeExtra(t *testing.T) {
+	const in = `{
+		"checksum": "a", "Checksum": "b", "version": 1, "x": [1, {"y": 2}],
+		"roots": {
+			"bookmark_bar": {"children": [
+				{"id": "2", "ID": "3", "name": "n", "type": "url", "url": "u", "date_added": "1", "z": null}
+			], "id": "1", "type": "folder", "guid": "` + string(BookmarkBarGUID) + `"},
+			"other": null,
+			"Synced": {}
+		}
+	}`
+	var b Bookmarks
+	if err := json.Unmarshal([]byte(in), &b); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if b.Checksum != "a" {
+		t.Errorf("checksum: got %q", b.Checksum)
+	}
+	n := (*b.Roots.BookmarkBar.Children)[0]
+	if n.ID != 2 || n.Name != "n" || n.URL != "u" || n.DateAdded != 1 || n.Type != NodeTypeURL {
+		t.Errorf("node: got %+v", n)
+	}
+
+	var act []string
+	for _, f := range b.UnknownFields() {
+		act = append(act, f.String())
+	}
+	exp := []string{
+		"Checksum",
+		"x",
+		"roots.Synced",
+		"roots.bookmark_bar.children[0].ID (node 2)",
+		"roots.bookmark_bar.children[0].z (node 2)",
+	}
+	if a, e := strings.Join(act, "\n"), strings.Join(exp, "\n"); a != e {
+		t.Errorf("unknown fields:\n%s\n\nexpected:\n%s", a, e)
+	}
+	if v := string(b.Extra["x"]); v != `[1, {"y": 2}]` {
+		t.Errorf("extra: got %s", v)
+	}
+
+	for _, x := range []string{
+		`{"roots": []}`,
+		`{"roots": {"other": {"children": {}}}}`,
+		`{"roots": {"other": {"id": 1}}}`,
+		`{"roots": {"other": {"id": "x"}}}`,
+		`{"roots": {"other": {"type": "x"}}}`,
+	} {
+		if err := json.Unmarshal([]byte(x), new(Bookmarks)); err == nil {
+			t.Errorf("unmarshal %s: expected error", x)
+		}
+	}
+}
+
+func TestMarshalExtraOrder(t *testing.T) {
+	var n BookmarkNode
+	if err := json.Unmarshal([]byte(`{"z": 1, "type": "url", "a": 2, "url": "u", "m": 3, "guid": "`+string(NewGUID())+`"}`), &n); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	buf, err := json.Marshal(n)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if exp := `"type":"url","url":"u","a":2,"m":3,"z":1}`; !strings.HasSuffix(string(buf), exp) {
+		t.Errorf("got %s, expected it to end with %s", buf, exp)
+	}
+}
+
+// codecTestBookmarks returns the bookmarks in testdata/Bookmarks.
+func codecTestBookmarks() *Bookmarks {
+	return &Bookmarks{
+		Checksum: "2fb68cbc9d7bcaf3dd2fbdfe924fd258",
+		Roots: Roots{
+			BookmarkBar: BookmarkNode{
+				Children: &[]BookmarkNode{
+					{
+						DateAdded:    13344473601000000,
+						DateLastUsed: 13344480000000000,
+						GUID:         "a8288040-0aca-4275-8a89-22175f088bd7",
+						ID:           5,
+						MetaInfo:     map[string]string{"power_bookmark_meta": ""},
+						Name:         "Example <b>Bold</b> & \"Quoted\"",
+						Type:         NodeTypeURL,
+						URL:          "https://example.com/?q=%3Cscript%3E&a=1",
+					},
+					{
+						Children: &[]BookmarkNode{
+							{
+								DateAdded: 13344473603000000,
+								GUID:      "efb9741f-485a-4be2-9a93-b219674b5d26",
+								ID:        7,
+								Name:      "Jira – Board ✓",
+								Type:      NodeTypeURL,
+								URL:       "https://jira.atlassian.net/",
+								Extra:     map[string]json.RawMessage{"sync_transaction_version": json.RawMessage(`"3"`)},
+							},
+							{
+								Children:  &[]BookmarkNode{},
+								DateAdded: 13344473604000000,
+								GUID:      "255df58e-68a5-4dec-8861-c389634379dc",
+								ID:        8,
+								Name:      "Empty",
+								Type:      NodeTypeFolder,
+							},
+						},
+						DateAdded:    13344473602000000,
+						DateModified: 13344473604000000,
+						GUID:         "0693760e-f141-4755-bc2c-d26e843cd4d2",
+						ID:           6,
+						Name:         "Work\tStuff",
+						Type:         NodeTypeFolder,
+					},
+				},
+				DateAdded:    13344473600000000,
+				DateModified: 13344473602000000,
+				GUID:         BookmarkBarGUID,
+				ID:           1,
+				Name:         "Bookmarks bar",
+				Type:         NodeTypeFolder,
+			},
+			Other: BookmarkNode{
+				Children:  &[]BookmarkNode{},
+				DateAdded: 13344473600000000,
+				GUID:      OtherBookmarksGUID,
+				ID:        2,
+				Name:      "Other bookmarks",
+				Type:      NodeTypeFolder,
+			},
+			MobileBookmark: BookmarkNode{
+				Children:  &[]BookmarkNode{},
+				DateAdded: 13344473600000000,
+				GUID:      MobileBookmarksGUID,
+				ID:        3,
+				Name:      "Mobile bookmarks",
+				Type:      NodeTypeFolder,
+			},
+		},
+		SyncMetadata: Bytes{0x0a, 0x04, 0x08, 0x01, 0x10, 0x01},
+		Version:      CurrentVersion,
+		Extra:        map[string]json.RawMessage{"sync_transaction_version": json.RawMessage(`"12"`)},
+	}
+}
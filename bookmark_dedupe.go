@@ -0,0 +1,246 @@
+package crb
+
+import (
+	"strings"
+
+	"github.com/pgaskin/crb/urlnorm"
+)
+
+// DedupeOptions controls how duplicates are found and removed.
+type DedupeOptions struct {
+	PerFolder  bool                  // only consider bookmarks in the same folder to be duplicates
+	Normalize  func(u string) string // normalizes urls for comparison (nil for urlnorm.Default and urlnorm.Fragment)
+	KeepNewest bool                  // keep the most recently added node rather than the oldest one
+
+	KeepFolders bool // don't merge sibling folders with the same name
+	KeepEmpty   bool // don't remove folders without any bookmarks
+}
+
+// DedupeNode is a node found by DedupeOptions.
+type DedupeNode struct {
+	*BookmarkNode
+	Path string
+}
+
+// DuplicateGroup is a set of nodes which are duplicates of each other.
+type DuplicateGroup struct {
+	Key   string       // the normalized url, or the path of the first folder
+	Keep  int          // the index of the node which would be kept
+	Nodes []DedupeNode // in tree order
+}
+
+// Duplicates are the duplicates found in a bookmarks file.
+type Duplicates struct {
+	URLs    []DuplicateGroup // bookmarks with the same normalized url
+	Folders []DuplicateGroup // sibling folders with the same name
+	Empty   []DedupeNode     // the topmost folders without any bookmarks, excluding permanent folders
+}
+
+// DedupeCount is the number of nodes changed by DedupeOptions.Dedupe.
+type DedupeCount struct {
+	URLs    int // the number of bookmarks removed
+	Folders int // the number of folders merged into a sibling
+	Empty   int // the number of empty folders removed
+}
+
+// Find finds duplicates in b.
+func (o DedupeOptions) Find(b *Bookmarks) *Duplicates {
+	d := new(Duplicates)
+	groups := map[string]int{}
+	b.walkPath(func(n *BookmarkNode, path []string) {
+		switch n.Type {
+		case NodeTypeURL:
+			k := o.normalize(n.URL)
+			g := k
+			if o.PerFolder {
+				g = strings.Join(path[:len(path)-1], "/") + "\x00" + k
+			}
+			i, ok := groups[g]
+			if !ok {
+				i = len(d.URLs)
+				groups[g] = i
+				d.URLs = append(d.URLs, DuplicateGroup{Key: k})
+			}
+			d.URLs[i].Nodes = append(d.URLs[i].Nodes, DedupeNode{n, strings.Join(path, "/")})
+		case NodeTypeFolder:
+			if n.Children == nil {
+				break
+			}
+			idx := map[string]int{}
+			var fs []DuplicateGroup
+			for i, e := range PathElements(*n.Children) {
+				if c := &(*n.Children)[i]; c.Type == NodeTypeFolder {
+					j, ok := idx[c.Name]
+					if !ok {
+						j = len(fs)
+						idx[c.Name] = j
+						fs = append(fs, DuplicateGroup{Key: strings.Join(append(path, e), "/")})
+					}
+					fs[j].Nodes = append(fs[j].Nodes, DedupeNode{c, strings.Join(append(path, e), "/")})
+				}
+			}
+			for _, g := range fs {
+				if len(g.Nodes) > 1 {
+					d.Folders = append(d.Folders, g)
+				}
+			}
+			if !b.IsRoot(n) && !n.hasURLs() {
+				var inEmpty bool
+				for _, e := range d.Empty {
+					if strings.HasPrefix(strings.Join(path, "/"), e.Path+"/") {
+						inEmpty = true
+						break
+					}
+				}
+				if !inEmpty {
+					d.Empty = append(d.Empty, DedupeNode{n, strings.Join(path, "/")})
+				}
+			}
+		}
+	})
+	urls := d.URLs[:0]
+	for _, g := range d.URLs {
+		if len(g.Nodes) > 1 {
+			urls = append(urls, g)
+		}
+	}
+	d.URLs = urls
+	for i := range d.URLs {
+		d.URLs[i].Keep = o.keep(d.URLs[i].Nodes)
+	}
+	for i := range d.Folders {
+		d.Folders[i].Keep = o.keep(d.Folders[i].Nodes)
+	}
+	return d
+}
+
+// Dedupe merges duplicate folders, then removes duplicate bookmarks, then
+// removes empty folders. The checksum is not updated.
+func (o DedupeOptions) Dedupe(b *Bookmarks) DedupeCount {
+	var c DedupeCount
+	if !o.KeepFolders {
+		for _, r := range b.roots() {
+			c.Folders += r.mergeFolders(o)
+		}
+	}
+	remove := map[*BookmarkNode]bool{}
+	for _, g := range o.Find(b).URLs {
+		for i, n := range g.Nodes {
+			if i != g.Keep {
+				remove[n.BookmarkNode] = true
+			}
+		}
+	}
+	c.URLs = len(remove)
+	for _, r := range b.roots() {
+		c.Empty += r.removeNodes(remove, !o.KeepEmpty)
+	}
+	return c
+}
+
+func (o DedupeOptions) normalize(u string) string {
+	if o.Normalize != nil {
+		return o.Normalize(u)
+	}
+	return (urlnorm.Default | urlnorm.Fragment).Normalize(u)
+}
+
+// keep returns the index of the node to keep.
+func (o DedupeOptions) keep(ns []DedupeNode) int {
+	var k int
+	for i, n := range ns {
+		if o.KeepNewest {
+			if n.DateAdded > ns[k].DateAdded {
+				k = i
+			}
+		} else {
+			if n.DateAdded < ns[k].DateAdded {
+				k = i
+			}
+		}
+	}
+	return k
+}
+
+// hasURLs returns true if n or any of its descendants is a bookmark.
+func (n *BookmarkNode) hasURLs() bool {
+	x, _ := n.find(func(c *BookmarkNode) bool {
+		return c.Type == NodeTypeURL
+	})
+	return n.Type == NodeTypeURL || x != nil
+}
+
+// mergeFolders merges child folders of n with the same name into the first one
+// (keeping the name, GUID, and dates of the one chosen by o), then does the
+// same for the children of the result. It returns the number of folders
+// merged.
+func (n *BookmarkNode) mergeFolders(o DedupeOptions) int {
+	if n.Children == nil {
+		return 0
+	}
+	var c int
+	idx := map[string]int{}
+	out := make([]BookmarkNode, 0, len(*n.Children))
+	for _, x := range *n.Children {
+		if x.Type != NodeTypeFolder {
+			out = append(out, x)
+			continue
+		}
+		i, ok := idx[x.Name]
+		if !ok {
+			idx[x.Name] = len(out)
+			out = append(out, x)
+			continue
+		}
+		var cs []BookmarkNode
+		if out[i].Children != nil {
+			cs = append(cs, *out[i].Children...)
+		}
+		if x.Children != nil {
+			cs = append(cs, *x.Children...)
+		}
+		if o.keep([]DedupeNode{{&out[i], ""}, {&x, ""}}) == 1 {
+			out[i] = x
+		}
+		out[i].Children = &cs
+		c++
+	}
+	if c != 0 {
+		*n.Children = out
+		n.touch()
+	}
+	for i := range *n.Children {
+		c += (&(*n.Children)[i]).mergeFolders(o)
+	}
+	return c
+}
+
+// removeNodes removes the descendants of n in the set, and if empty is true,
+// folders which don't contain any bookmarks afterwards. It returns the number
+// of empty folders removed.
+func (n *BookmarkNode) removeNodes(set map[*BookmarkNode]bool, empty bool) int {
+	if n.Children == nil {
+		return 0
+	}
+	var c int
+	for i := range *n.Children {
+		c += (&(*n.Children)[i]).removeNodes(set, empty)
+	}
+	out := (*n.Children)[:0]
+	for i := range *n.Children {
+		x := &(*n.Children)[i]
+		if set[x] {
+			continue
+		}
+		if empty && x.Type == NodeTypeFolder && !x.hasURLs() {
+			c++
+			continue
+		}
+		out = append(out, *x)
+	}
+	if len(out) != len(*n.Children) {
+		*n.Children = out
+		n.touch()
+	}
+	return c
+}
@@ -0,0 +1,286 @@
+package crb
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ChangeKind is the type of a Change.
+type ChangeKind string
+
+const (
+	ChangeAdded     ChangeKind = "added"
+	ChangeRemoved   ChangeKind = "removed"
+	ChangeMoved     ChangeKind = "moved"     // to a different folder
+	ChangeReordered ChangeKind = "reordered" // within the same folder
+	ChangeRenamed   ChangeKind = "renamed"
+	ChangeURL       ChangeKind = "url"
+	ChangeMeta      ChangeKind = "meta" // a meta_info key was added, removed, or changed
+)
+
+// Change is a difference between two bookmark trees.
+type Change struct {
+	Kind     ChangeKind
+	Old, New *BookmarkNode // the node in the old tree (nil if added) and new tree (nil if removed)
+
+	OldPath, NewPath   string // empty if the node isn't in the tree
+	OldIndex, NewIndex int    // the index of the node in its parent, or -1
+
+	Key                string // the meta_info key
+	OldValue, NewValue string // the old and new name, url, or meta_info value
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case ChangeAdded:
+		return fmt.Sprintf("added %s", c.NewPath)
+	case ChangeRemoved:
+		return fmt.Sprintf("removed %s", c.OldPath)
+	case ChangeMoved:
+		return fmt.Sprintf("moved %s to %s", c.OldPath, c.NewPath)
+	case ChangeReordered:
+		return fmt.Sprintf("reordered %s (index %d to %d)", c.NewPath, c.OldIndex, c.NewIndex)
+	case ChangeRenamed:
+		return fmt.Sprintf("renamed %s from %q to %q", c.NewPath, c.OldValue, c.NewValue)
+	case ChangeURL:
+		return fmt.Sprintf("changed url of %s from %q to %q", c.NewPath, c.OldValue, c.NewValue)
+	case ChangeMeta:
+		_, o := c.Old.MetaInfo[c.Key]
+		_, n := c.New.MetaInfo[c.Key]
+		switch {
+		case !o:
+			return fmt.Sprintf("added meta_info %q to %s (%q)", c.Key, c.NewPath, c.NewValue)
+		case !n:
+			return fmt.Sprintf("removed meta_info %q from %s (%q)", c.Key, c.NewPath, c.OldValue)
+		default:
+			return fmt.Sprintf("changed meta_info %q of %s from %q to %q", c.Key, c.NewPath, c.OldValue, c.NewValue)
+		}
+	default:
+		return fmt.Sprintf("%s %s", c.Kind, c.NewPath)
+	}
+}
+
+// DiffOptions controls how bookmark trees are compared.
+type DiffOptions struct {
+	NormalizeURL func(u string) string // if not nil, only report url changes if the normalized urls differ
+}
+
+// Diff is like DiffOptions.Diff with the default options.
+func Diff(a, b *Bookmarks) []Change {
+	return DiffOptions{}.Diff(a, b)
+}
+
+// Diff compares the bookmark trees a and b, returning the changes from a to b.
+// Nodes are matched by GUID, or by ID if either node doesn't have a valid
+// GUID. Removals are returned first in the order of a, followed by the
+// remaining changes in the order of b. Only the topmost node of an added or
+// removed subtree is returned, but nodes moved into an added folder or out of a
+// removed one are also returned as moved. Only the meta_info (not
+// unsynced_meta_info) is compared.
+func (o DiffOptions) Diff(a, b *Bookmarks) []Change {
+	an, bn := a.diffNodes(), b.diffNodes()
+	matchNodes(an, bn)
+
+	var cs []Change
+	for _, x := range an {
+		if x.match == nil && (x.parent == nil || x.parent.match != nil) {
+			cs = append(cs, Change{
+				Kind:     ChangeRemoved,
+				Old:      x.n,
+				OldPath:  x.path,
+				OldIndex: x.index,
+				NewIndex: -1,
+			})
+		}
+	}
+
+	reordered := map[*diffNode]bool{}
+	for _, y := range bn {
+		if y.match == nil || y.n.Children == nil {
+			continue
+		}
+		// the longest increasing subsequence of the old indexes of the
+		// children which stayed in the folder is the largest set which
+		// didn't move relative to each other
+		var kept []*diffNode
+		for _, c := range y.children {
+			if c.match != nil && c.match.parent == y.match {
+				kept = append(kept, c)
+			}
+		}
+		lis := map[*diffNode]bool{}
+		for _, i := range longestIncreasing(len(kept), func(i int) int { return kept[i].match.index }) {
+			lis[kept[i]] = true
+		}
+		for _, c := range kept {
+			if !lis[c] {
+				reordered[c] = true
+			}
+		}
+	}
+
+	for _, y := range bn {
+		x := y.match
+		c := Change{
+			New:      y.n,
+			NewPath:  y.path,
+			OldIndex: -1,
+			NewIndex: y.index,
+		}
+		if x == nil {
+			if y.parent != nil && y.parent.match != nil {
+				c.Kind = ChangeAdded
+				cs = append(cs, c)
+			}
+			continue
+		}
+		c.Old, c.OldPath, c.OldIndex = x.n, x.path, x.index
+		if x.parent != nil && y.parent != nil && x.parent.match != y.parent {
+			c.Kind = ChangeMoved
+			cs = append(cs, c)
+		}
+		if reordered[y] {
+			c.Kind = ChangeReordered
+			cs = append(cs, c)
+		}
+		if x.n.Name != y.n.Name {
+			c.Kind, c.OldValue, c.NewValue = ChangeRenamed, x.n.Name, y.n.Name
+			cs = append(cs, c)
+		}
+		if x.n.URL != y.n.URL && (o.NormalizeURL == nil || o.NormalizeURL(x.n.URL) != o.NormalizeURL(y.n.URL)) {
+			c.Kind, c.OldValue, c.NewValue = ChangeURL, x.n.URL, y.n.URL
+			cs = append(cs, c)
+		}
+		var keys []string
+		for k, v := range x.n.MetaInfo {
+			if w, ok := y.n.MetaInfo[k]; !ok || v != w {
+				keys = append(keys, k)
+			}
+		}
+		for k := range y.n.MetaInfo {
+			if _, ok := x.n.MetaInfo[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			c.Kind, c.Key, c.OldValue, c.NewValue = ChangeMeta, k, x.n.MetaInfo[k], y.n.MetaInfo[k]
+			cs = append(cs, c)
+		}
+	}
+	return cs
+}
+
+type diffNode struct {
+	n        *BookmarkNode
+	parent   *diffNode // nil for permanent folders
+	children []*diffNode
+	path     string
+	index    int // -1 for permanent folders
+	match    *diffNode
+}
+
+// diffNodes returns the nodes of b in tree order.
+func (b *Bookmarks) diffNodes() []*diffNode {
+	var ns []*diffNode
+	var walk func(n *BookmarkNode, parent *diffNode, path string, index int) *diffNode
+	walk = func(n *BookmarkNode, parent *diffNode, path string, index int) *diffNode {
+		x := &diffNode{n: n, parent: parent, path: path, index: index}
+		ns = append(ns, x)
+		if n.Children != nil {
+			for i, e := range PathElements(*n.Children) {
+				x.children = append(x.children, walk(&(*n.Children)[i], x, path+"/"+e, i))
+			}
+		}
+		return x
+	}
+	for _, r := range b.roots() {
+		walk(r, nil, EscapePathElement(r.Name), -1)
+	}
+	return ns
+}
+
+// matchNodes matches the permanent folders by type, then the remaining nodes
+// by GUID, then by ID if either node doesn't have a valid GUID.
+func matchNodes(a, b []*diffNode) {
+	link := func(x, y *diffNode) {
+		x.match, y.match = y, x
+	}
+
+	var ar, br []*diffNode
+	for _, x := range a {
+		if x.parent == nil {
+			ar = append(ar, x)
+		}
+	}
+	for _, y := range b {
+		if y.parent == nil {
+			br = append(br, y)
+		}
+	}
+	for i := range ar {
+		link(ar[i], br[i])
+	}
+
+	guids := map[[16]byte]*diffNode{}
+	for _, y := range b {
+		if g, err := y.n.GUID.Bytes(); err == nil && y.match == nil {
+			if _, ok := guids[g]; !ok {
+				guids[g] = y
+			}
+		}
+	}
+	for _, x := range a {
+		if g, err := x.n.GUID.Bytes(); err == nil && x.match == nil {
+			if y := guids[g]; y != nil && y.match == nil {
+				link(x, y)
+			}
+		}
+	}
+
+	ids := map[int]*diffNode{}
+	for _, y := range b {
+		if _, ok := ids[y.n.ID]; !ok && y.match == nil {
+			ids[y.n.ID] = y
+		}
+	}
+	for _, x := range a {
+		if y := ids[x.n.ID]; y != nil && y.match == nil && x.match == nil {
+			if _, err := x.n.GUID.Bytes(); err != nil {
+				link(x, y)
+			} else if _, err := y.n.GUID.Bytes(); err != nil {
+				link(x, y)
+			}
+		}
+	}
+}
+
+// longestIncreasing returns the indexes of the longest strictly increasing
+// subsequence of the n values returned by v.
+func longestIncreasing(n int, v func(i int) int) []int {
+	var tails []int // index of the smallest tail of each length
+	prev := make([]int, n)
+	for i := 0; i < n; i++ {
+		j := sort.Search(len(tails), func(j int) bool {
+			return v(tails[j]) >= v(i)
+		})
+		if j > 0 {
+			prev[i] = tails[j-1]
+		} else {
+			prev[i] = -1
+		}
+		if j == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[j] = i
+		}
+	}
+	if len(tails) == 0 {
+		return nil
+	}
+	r := make([]int, len(tails))
+	for i, j := len(r)-1, tails[len(tails)-1]; i >= 0; i, j = i-1, prev[j] {
+		r[i] = j
+	}
+	return r
+}
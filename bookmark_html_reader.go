@@ -0,0 +1,279 @@
+package crb
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FaviconSetFunc is called with the data URL of the favicon for url when
+// importing bookmarks.
+type FaviconSetFunc func(url, dataURL string)
+
+// Import reads a Netscape HTML bookmark export (as written by Export, Chrome,
+// Firefox, Safari, Edge, or IE) from r.
+//
+// The contents of the personal toolbar folder are placed in the bookmarks bar,
+// and everything else is placed in the other bookmarks folder. IDs and GUIDs
+// are assigned, and the checksum is calculated.
+func Import(r io.Reader) (*Bookmarks, error) {
+	return ImportFavicons(r, nil)
+}
+
+// ImportFavicons is like Import, but also calls f with the favicon of each
+// bookmark which has one.
+func ImportFavicons(r io.Reader, f FaviconSetFunc) (*Bookmarks, error) {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		now     Time
+		top     = new([]BookmarkNode)
+		toolbar *[]BookmarkNode
+		unfiled []*[]BookmarkNode
+		stack   = []*[]BookmarkNode{top}
+		folder  *[]BookmarkNode // the folder which the next DL opens
+		cur     *BookmarkNode   // the A or H3 we're reading the name of
+		curTag  string
+		name    strings.Builder
+		sawDL   bool
+	)
+	now.SetTime(time.Now())
+
+	for p := buf; len(p) != 0; {
+		i := bytes.IndexByte(p, '<')
+		if i == -1 {
+			i = len(p)
+		}
+		if cur != nil {
+			name.Write(p[:i])
+		}
+		if p = p[i:]; len(p) == 0 {
+			break
+		}
+
+		if bytes.HasPrefix(p, []byte("<!--")) {
+			if j := bytes.Index(p, []byte("-->")); j != -1 {
+				p = p[j+3:]
+			} else {
+				p = nil
+			}
+			continue
+		}
+
+		tag, attr, end, n := importTag(p)
+		if n == 0 {
+			if cur != nil {
+				name.WriteByte('<')
+			}
+			p = p[1:]
+			continue
+		}
+		p = p[n:]
+
+		if cur != nil {
+			if !end || tag != curTag {
+				continue // ignore any other markup within the name
+			}
+			cur.Name = strings.TrimSpace(html.UnescapeString(name.String()))
+			name.Reset()
+			cur = nil
+			continue
+		}
+
+		switch {
+		case tag == "a" && !end:
+			n := BookmarkNode{
+				DateAdded: importTime(attr["add_date"], now),
+				Type:      NodeTypeURL,
+				URL:       attr["href"],
+			}
+			c := stack[len(stack)-1]
+			*c = append(*c, n)
+			cur, curTag = &(*c)[len(*c)-1], tag
+			if v, ok := attr["icon"]; ok && v != "" && f != nil {
+				f(n.URL, v)
+			}
+			folder = nil
+		case tag == "h3" && !end:
+			n := BookmarkNode{
+				Children:     new([]BookmarkNode),
+				DateAdded:    importTime(attr["add_date"], now),
+				DateModified: importTime(attr["last_modified"], 0),
+				Type:         NodeTypeFolder,
+			}
+			c := stack[len(stack)-1]
+			*c = append(*c, n)
+			cur, curTag = &(*c)[len(*c)-1], tag
+			if len(stack) == 1 {
+				if strings.EqualFold(attr["personal_toolbar_folder"], "true") && toolbar == nil {
+					toolbar = n.Children
+				} else if strings.EqualFold(attr["unfiled_bookmarks_folder"], "true") {
+					unfiled = append(unfiled, n.Children)
+				}
+			}
+			folder = n.Children
+		case tag == "dl" && !end:
+			if folder != nil {
+				stack = append(stack, folder)
+				folder = nil
+			} else if sawDL {
+				stack = append(stack, stack[len(stack)-1]) // stray list, so keep adding to the current folder
+			}
+			sawDL = true
+		case tag == "dl" && end:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+			folder = nil
+		}
+	}
+	if !sawDL {
+		return nil, fmt.Errorf("not a netscape bookmark file")
+	}
+
+	var b Bookmarks
+	b.Version = CurrentVersion
+	b.Roots.BookmarkBar = importRoot("Bookmarks bar", BookmarkBarGUID, now)
+	b.Roots.Other = importRoot("Other bookmarks", OtherBookmarksGUID, now)
+	b.Roots.MobileBookmark = importRoot("Mobile bookmarks", MobileBookmarksGUID, now)
+
+	for _, n := range *top {
+		switch {
+		case toolbar != nil && n.Children == toolbar:
+			*b.Roots.BookmarkBar.Children = append(*b.Roots.BookmarkBar.Children, *n.Children...)
+			b.Roots.BookmarkBar.DateAdded = n.DateAdded
+			b.Roots.BookmarkBar.DateModified = n.DateModified
+		case n.Children != nil && importContains(unfiled, n.Children):
+			*b.Roots.Other.Children = append(*b.Roots.Other.Children, *n.Children...)
+		default:
+			*b.Roots.Other.Children = append(*b.Roots.Other.Children, n)
+		}
+	}
+
+	b.ReassignIDs()
+	b.find(func(n *BookmarkNode) bool {
+		if n.GUID == "" {
+			n.GUID = NewGUID()
+		}
+		return false
+	})
+	b.UpdateChecksum()
+	return &b, nil
+}
+
+func importRoot(name string, guid GUID, now Time) BookmarkNode {
+	return BookmarkNode{
+		Children:  new([]BookmarkNode),
+		DateAdded: now,
+		GUID:      guid,
+		Name:      name,
+		Type:      NodeTypeFolder,
+	}
+}
+
+func importContains(s []*[]BookmarkNode, c *[]BookmarkNode) bool {
+	for _, x := range s {
+		if x == c {
+			return true
+		}
+	}
+	return false
+}
+
+// importTime parses a timestamp from a bookmark export. Most browsers use
+// seconds, but some versions of Firefox used microseconds or milliseconds.
+func importTime(s string, def Time) Time {
+	v, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || v <= 0 {
+		return def
+	}
+	var t Time
+	switch {
+	case v >= 1e14:
+		t.SetTime(time.UnixMicro(v))
+	case v >= 1e11:
+		t.SetTime(time.UnixMilli(v))
+	default:
+		t.SetTime(time.Unix(v, 0))
+	}
+	return t
+}
+
+// importTag parses the HTML tag at the beginning of p, returning the lowercase
+// tag name and attribute names, and the number of bytes consumed. If p does not
+// start with a tag, n is zero.
+func importTag(p []byte) (tag string, attr map[string]string, end bool, n int) {
+	if len(p) < 2 || p[0] != '<' {
+		return "", nil, false, 0
+	}
+	i := 1
+	if p[i] == '/' {
+		end = true
+		i++
+	}
+	j := i
+	for j < len(p) && importIsNameChar(p[j]) {
+		j++
+	}
+	if j == i {
+		return "", nil, false, 0
+	}
+	tag = strings.ToLower(string(p[i:j]))
+
+	attr = map[string]string{}
+	for i = j; ; {
+		for i < len(p) && importIsSpace(p[i]) {
+			i++
+		}
+		if i >= len(p) {
+			return tag, attr, end, len(p)
+		}
+		if p[i] == '>' {
+			return tag, attr, end, i + 1
+		}
+		if p[i] == '/' {
+			i++
+			continue
+		}
+		j = i
+		for j < len(p) && !importIsSpace(p[j]) && p[j] != '=' && p[j] != '>' {
+			j++
+		}
+		k := strings.ToLower(string(p[i:j]))
+		if i = j; i == len(p) || p[i] != '=' {
+			attr[k] = ""
+			continue
+		}
+		for i++; i < len(p) && importIsSpace(p[i]); i++ {
+		}
+		var v []byte
+		if i < len(p) && (p[i] == '"' || p[i] == '\'') {
+			q := p[i]
+			if j = bytes.IndexByte(p[i+1:], q); j == -1 {
+				v, i = p[i+1:], len(p)
+			} else {
+				v, i = p[i+1:i+1+j], i+2+j
+			}
+		} else {
+			for j = i; j < len(p) && !importIsSpace(p[j]) && p[j] != '>'; j++ {
+			}
+			v, i = p[i:j], j
+		}
+		attr[k] = html.UnescapeString(string(v))
+	}
+}
+
+func importIsNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func importIsSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
@@ -0,0 +1,67 @@
+package crb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImport(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "bookmarks.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	start := time.Now().Unix()
+	b, err := Import(f)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+
+	// path, url, and the unix add and modification dates (* if it was set to
+	// the import time, - if unset)
+	date := func(x Time) string {
+		switch {
+		case x.IsZero():
+			return "-"
+		case x.Unix() >= start:
+			return "*"
+		default:
+			return fmt.Sprint(x.Unix())
+		}
+	}
+	var act []string
+	for p, n := range b.All() {
+		act = append(act, fmt.Sprintf("%s %q %s %s", strings.Join(p, "/"), n.URL, date(n.DateAdded), date(n.DateModified)))
+	}
+	exp := []string{
+		`Bookmarks bar "" 1620383415 1620383500`,
+		`Bookmarks bar/Example <b>Bold</b> & "Quoted" "https://example.com/" 1620383416 -`,
+		`Bookmarks bar/Work "" 1620383417 1620383418`,
+		`Bookmarks bar/Work/Jira – Board ✓ "https://jira.example.com/?a=1&b=2" 1620383419 -`,
+		`Bookmarks bar/Work/Nested "" 1620383420 -`,
+		`Bookmarks bar/Work/Nested/It's nested "https://example.org/" 1620383421 -`,
+		`Bookmarks bar/No date "https://example.net/" * -`,
+		`Other bookmarks "" * -`,
+		`Other bookmarks/Other "https://other.example.com/" 1620383422 -`,
+		`Other bookmarks/Folder "" 1620383423 1620383424`,
+		`Mobile bookmarks "" * -`,
+	}
+	if a, e := strings.Join(act, "\n"), strings.Join(exp, "\n"); a != e {
+		t.Errorf("unexpected tree:\n%s\n\nexpected:\n%s", a, e)
+	}
+
+	for _, p := range b.Validate() {
+		t.Errorf("validate: %s", p)
+	}
+}
+
+func TestImportNotNetscape(t *testing.T) {
+	if _, err := Import(strings.NewReader("<html><body><a href=\"https://example.com/\">x</a></body></html>")); err == nil {
+		t.Errorf("expected error")
+	}
+}
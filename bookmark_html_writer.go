@@ -23,14 +23,37 @@ func Export(w io.Writer, b *Bookmarks, f FaviconFunc) error {
 		"<TITLE>Bookmarks</TITLE>\r\n" +
 		"<H1>Bookmarks</H1>\r\n" +
 		"<DL><p>\r\n")
-	exportNode(wr, b.Roots.BookmarkBar, f, 1, "bookmark_bar")
-	exportNode(wr, b.Roots.Other, f, 1, "other")
-	exportNode(wr, b.Roots.MobileBookmark, f, 1, "synced")
+	b.Visit(Visitor{
+		Enter: func(n *BookmarkNode, s VisitState) error {
+			if s.Depth == 0 && s.Root != RootBookmarkBar {
+				return nil // the contents of the other folders are written at the top level
+			}
+			exportNode(wr, n, f, exportIndent(s), s.Depth == 0)
+			return nil
+		},
+		Leave: func(n *BookmarkNode, s VisitState) error {
+			if s.Depth == 0 && s.Root != RootBookmarkBar {
+				return nil
+			}
+			for i := 0; i < exportIndent(s); i++ {
+				wr.WriteString("    ")
+			}
+			wr.WriteString("</DL><p>\r\n")
+			return nil
+		},
+	})
 	wr.WriteString("</DL><p>\r\n")
 	return wr.Flush()
 }
 
-func exportNode(wr *bufio.Writer, n BookmarkNode, f FaviconFunc, indent int, specialType string) {
+func exportIndent(s VisitState) int {
+	if s.Root == RootBookmarkBar {
+		return s.Depth + 1
+	}
+	return s.Depth
+}
+
+func exportNode(wr *bufio.Writer, n *BookmarkNode, f FaviconFunc, indent int, toolbar bool) {
 	switch n.Type {
 	case NodeTypeURL:
 		for i := 0; i < indent; i++ {
@@ -58,48 +81,30 @@ func exportNode(wr *bufio.Writer, n BookmarkNode, f FaviconFunc, indent int, spe
 		wr.WriteString(escapeHTML(n.Name, false))
 		wr.WriteString("</A>\r\n")
 	case NodeTypeFolder:
-		switch specialType {
-		case "other", "synced":
-			if n.Children != nil {
-				for _, c := range *n.Children {
-					exportNode(wr, c, f, indent, "")
-				}
-			}
-		default:
-			for i := 0; i < indent; i++ {
-				wr.WriteString("    ")
-			}
-			wr.WriteString("<DT><H3")
-			if !n.DateAdded.IsZero() {
-				wr.WriteString(" ADD_DATE=\"")
-				wr.WriteString(strconv.FormatInt(n.DateAdded.Unix(), 10))
-				wr.WriteString("\"")
-			}
-			if !n.DateModified.IsZero() {
-				wr.WriteString(" LAST_MODIFIED=\"")
-				wr.WriteString(strconv.FormatInt(n.DateModified.Unix(), 10))
-				wr.WriteString("\"")
-			}
-			if specialType == "bookmark_bar" {
-				wr.WriteString(" PERSONAL_TOOLBAR_FOLDER=\"true\"")
-			}
-			wr.WriteString(">")
-			wr.WriteString(escapeHTML(n.Name, false))
-			wr.WriteString("</H3>\r\n")
-			for i := 0; i < indent; i++ {
-				wr.WriteString("    ")
-			}
-			wr.WriteString("<DL><p>\r\n")
-			if n.Children != nil {
-				for _, c := range *n.Children {
-					exportNode(wr, c, f, indent+1, "")
-				}
-			}
-			for i := 0; i < indent; i++ {
-				wr.WriteString("    ")
-			}
-			wr.WriteString("</DL><p>\r\n")
+		for i := 0; i < indent; i++ {
+			wr.WriteString("    ")
+		}
+		wr.WriteString("<DT><H3")
+		if !n.DateAdded.IsZero() {
+			wr.WriteString(" ADD_DATE=\"")
+			wr.WriteString(strconv.FormatInt(n.DateAdded.Unix(), 10))
+			wr.WriteString("\"")
+		}
+		if !n.DateModified.IsZero() {
+			wr.WriteString(" LAST_MODIFIED=\"")
+			wr.WriteString(strconv.FormatInt(n.DateModified.Unix(), 10))
+			wr.WriteString("\"")
+		}
+		if toolbar {
+			wr.WriteString(" PERSONAL_TOOLBAR_FOLDER=\"true\"")
+		}
+		wr.WriteString(">")
+		wr.WriteString(escapeHTML(n.Name, false))
+		wr.WriteString("</H3>\r\n")
+		for i := 0; i < indent; i++ {
+			wr.WriteString("    ")
 		}
+		wr.WriteString("<DL><p>\r\n")
 	}
 }
 
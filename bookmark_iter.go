@@ -0,0 +1,64 @@
+package crb
+
+import "iter"
+
+// All returns an iterator over the folders and bookmarks in b depth-first,
+// starting with each permanent folder. The path contains the names of the node
+// and its ancestors (use JoinPath to format it), and must not be retained.
+func (b *Bookmarks) All() iter.Seq2[[]string, *BookmarkNode] {
+	return func(yield func([]string, *BookmarkNode) bool) {
+		var path []string
+		for _, r := range b.roots() {
+			if !r.all(&path, yield) {
+				return
+			}
+		}
+	}
+}
+
+// URLs is like All, but only returns bookmarks.
+func (b *Bookmarks) URLs() iter.Seq2[[]string, *BookmarkNode] {
+	return filterSeq(b.All(), NodeTypeURL)
+}
+
+// Folders is like All, but only returns folders.
+func (b *Bookmarks) Folders() iter.Seq2[[]string, *BookmarkNode] {
+	return filterSeq(b.All(), NodeTypeFolder)
+}
+
+// Descendants returns an iterator over the descendants of n depth-first. The
+// path contains the names of the node and its ancestors up to (but not
+// including) n, and must not be retained.
+func (n *BookmarkNode) Descendants() iter.Seq2[[]string, *BookmarkNode] {
+	return func(yield func([]string, *BookmarkNode) bool) {
+		var path []string
+		n.children(&path, yield)
+	}
+}
+
+func (n *BookmarkNode) all(path *[]string, yield func([]string, *BookmarkNode) bool) bool {
+	*path = append(*path, n.Name)
+	defer func() { *path = (*path)[:len(*path)-1] }()
+	return yield(*path, n) && n.children(path, yield)
+}
+
+func (n *BookmarkNode) children(path *[]string, yield func([]string, *BookmarkNode) bool) bool {
+	if n.Type == NodeTypeFolder && n.Children != nil {
+		for i := range *n.Children {
+			if !(&(*n.Children)[i]).all(path, yield) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func filterSeq(seq iter.Seq2[[]string, *BookmarkNode], t NodeType) iter.Seq2[[]string, *BookmarkNode] {
+	return func(yield func([]string, *BookmarkNode) bool) {
+		for path, n := range seq {
+			if n.Type == t && !yield(path, n) {
+				return
+			}
+		}
+	}
+}
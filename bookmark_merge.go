@@ -0,0 +1,451 @@
+package crb
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// ConflictKind is the type of a Conflict.
+type ConflictKind string
+
+const (
+	ConflictField  ConflictKind = "field"  // both sides changed a field differently, ours was kept
+	ConflictDelete ConflictKind = "delete" // one side deleted a node the other side changed or added to, the node was kept
+	ConflictMove   ConflictKind = "move"   // both sides moved a node to different folders, ours was kept
+	ConflictCycle  ConflictKind = "cycle"  // the moves from both sides would have put a folder inside itself, ours was kept
+	ConflictOrder  ConflictKind = "order"  // both sides reordered the children of a folder differently, ours was kept
+)
+
+// Conflict is a change which couldn't be merged automatically.
+type Conflict struct {
+	Kind ConflictKind
+	GUID GUID   // the node, or empty if it doesn't have one
+	Path string // the path of the node in the merged tree
+
+	Field              string // the field for ConflictField (name, url, or meta_info.key)
+	Side               string // the side which deleted the node for ConflictDelete (ours or theirs)
+	Base, Ours, Theirs string // the values for ConflictField, or the paths of the parent folders for ConflictMove
+}
+
+func (c Conflict) String() string {
+	switch c.Kind {
+	case ConflictField:
+		return fmt.Sprintf("%s: both sides changed %s (base %q, ours %q, theirs %q), kept ours", c.Path, c.Field, c.Base, c.Ours, c.Theirs)
+	case ConflictDelete:
+		return fmt.Sprintf("%s: deleted by %s but changed by the other side, kept it", c.Path, c.Side)
+	case ConflictMove:
+		return fmt.Sprintf("%s: both sides moved it (ours to %s, theirs to %s), kept ours", c.Path, c.Ours, c.Theirs)
+	case ConflictCycle:
+		return fmt.Sprintf("%s: moves would put a folder inside itself, kept ours", c.Path)
+	case ConflictOrder:
+		return fmt.Sprintf("%s: both sides reordered the children differently, kept ours", c.Path)
+	default:
+		return fmt.Sprintf("%s: %s conflict", c.Path, c.Kind)
+	}
+}
+
+// Merge does a three-way merge of the changes from base to ours and theirs.
+// Nodes are matched by GUID, or by ID if they don't have a valid GUID. Changes
+// to the name, url, meta_info, parent folder, and order of children are
+// merged. If both sides made conflicting changes, ours is preferred, and the
+// conflict is returned. The merged tree has new IDs and an updated checksum.
+// Other fields of the bookmarks file are taken from ours.
+func Merge(base, ours, theirs *Bookmarks) (*Bookmarks, []Conflict) {
+	var (
+		bt, ot, tt = newMergeTree(base), newMergeTree(ours), newMergeTree(theirs)
+		keys       []string
+		st         = map[string]*mergeState{}
+		cs         []Conflict
+		ck         []string // the key of each conflict
+	)
+	for _, t := range []*mergeTree{ot, tt, bt} {
+		for _, k := range t.order {
+			if _, ok := st[k]; !ok {
+				st[k] = &mergeState{
+					base:   bt.nodes[k],
+					ours:   ot.nodes[k],
+					theirs: tt.nodes[k],
+				}
+				keys = append(keys, k)
+			}
+		}
+	}
+	conflict := func(k string, c Conflict) {
+		cs, ck = append(cs, c), append(ck, k)
+	}
+
+	// determine which nodes exist
+	for _, k := range keys {
+		s := st[k]
+		switch {
+		case s.ours != nil && s.theirs != nil:
+			s.alive = true
+		case s.base == nil:
+			s.alive = true // added by one side
+		case s.ours == nil && s.theirs == nil:
+			s.alive = false // deleted by both sides
+		case s.ours == nil:
+			if s.alive = s.base.changed(s.theirs); s.alive {
+				conflict(k, Conflict{Kind: ConflictDelete, Side: "ours"})
+			}
+		case s.theirs == nil:
+			if s.alive = s.base.changed(s.ours); s.alive {
+				conflict(k, Conflict{Kind: ConflictDelete, Side: "theirs"})
+			}
+		}
+	}
+
+	// determine the parent of each node
+	for _, k := range keys {
+		s := st[k]
+		switch {
+		case s.ours == nil && s.theirs == nil:
+			s.parent = s.base.parent
+		case s.ours == nil:
+			s.parent = s.theirs.parent
+		case s.theirs == nil:
+			s.parent = s.ours.parent
+		case s.ours.parent == s.theirs.parent:
+			s.parent = s.ours.parent
+		case s.base != nil && s.ours.parent == s.base.parent:
+			s.parent = s.theirs.parent
+		case s.base != nil && s.theirs.parent == s.base.parent:
+			s.parent = s.ours.parent
+		default:
+			s.parent = s.ours.parent
+			conflict(k, Conflict{Kind: ConflictMove, Ours: ot.nodes[s.ours.parent].path, Theirs: tt.nodes[s.theirs.parent].path})
+		}
+	}
+
+	// keep deleted folders which still have children, and break cycles
+	for changed := true; changed; {
+		changed = false
+		for _, k := range keys {
+			if s := st[k]; s.alive && s.parent != "" && !st[s.parent].alive {
+				p := st[s.parent]
+				p.alive, changed = true, true
+				side := "ours"
+				if p.theirs == nil {
+					side = "theirs"
+				}
+				conflict(s.parent, Conflict{Kind: ConflictDelete, Side: side})
+			}
+		}
+		for _, k := range keys {
+			if s := st[k]; !s.alive || s.parent == "" {
+				continue
+			}
+			var found bool
+			cycle, seen := []string{k}, map[string]bool{k: true}
+			for x := st[k].parent; x != "" && !seen[x]; x = st[x].parent {
+				seen[x] = true
+				cycle = append(cycle, x)
+				if found = st[x].parent == k; found {
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+			var fixed bool
+			for _, x := range cycle {
+				if s := st[x]; s.ours != nil && s.parent != s.ours.parent {
+					s.parent, fixed = s.ours.parent, true
+					conflict(x, Conflict{Kind: ConflictCycle})
+				}
+			}
+			if !fixed {
+				st[k].parent = "root:" + string(RootOther)
+				conflict(k, Conflict{Kind: ConflictCycle})
+			}
+			changed = true
+		}
+	}
+
+	// merge the fields
+	for _, k := range keys {
+		s := st[k]
+		if !s.alive {
+			continue
+		}
+		var e [3]*BookmarkNode // base, ours, theirs
+		for i, x := range []*mergeEntry{s.base, s.ours, s.theirs} {
+			if x != nil {
+				e[i] = x.n
+			}
+		}
+		switch {
+		case e[1] != nil:
+			s.n = *e[1]
+		case e[2] != nil:
+			s.n = *e[2]
+		default:
+			s.n = *e[0]
+		}
+		s.n.Children = nil
+		if s.n.Type == NodeTypeFolder {
+			s.n.Children = new([]BookmarkNode)
+		}
+		field := func(name string, get func(n *BookmarkNode) (string, bool)) (string, bool) {
+			var v [3]string
+			var ok [3]bool
+			for i, n := range e {
+				if n != nil {
+					v[i], ok[i] = get(n)
+				}
+			}
+			switch {
+			case e[1] == nil:
+				return v[2], ok[2]
+			case e[2] == nil:
+				return v[1], ok[1]
+			case v[1] == v[2] && ok[1] == ok[2]:
+				return v[1], ok[1]
+			case e[0] != nil && v[1] == v[0] && ok[1] == ok[0]:
+				return v[2], ok[2]
+			case e[0] != nil && v[2] == v[0] && ok[2] == ok[0]:
+				return v[1], ok[1]
+			}
+			conflict(k, Conflict{Kind: ConflictField, Field: name, Base: v[0], Ours: v[1], Theirs: v[2]})
+			return v[1], ok[1]
+		}
+		s.n.Name, _ = field("name", func(n *BookmarkNode) (string, bool) {
+			return n.Name, true
+		})
+		s.n.URL, _ = field("url", func(n *BookmarkNode) (string, bool) {
+			return n.URL, true
+		})
+		var mk []string
+		for _, n := range e {
+			if n != nil {
+				for x := range n.MetaInfo {
+					mk = append(mk, x)
+				}
+			}
+		}
+		sort.Strings(mk)
+		s.n.MetaInfo = nil
+		for i, x := range mk {
+			if i != 0 && mk[i-1] == x {
+				continue
+			}
+			if v, ok := field("meta_info."+x, func(n *BookmarkNode) (string, bool) {
+				v, ok := n.MetaInfo[x]
+				return v, ok
+			}); ok {
+				if s.n.MetaInfo == nil {
+					s.n.MetaInfo = map[string]string{}
+				}
+				s.n.MetaInfo[x] = v
+			}
+		}
+		for _, n := range e {
+			if n != nil {
+				if n.DateLastUsed > s.n.DateLastUsed {
+					s.n.DateLastUsed = n.DateLastUsed
+				}
+				if n.DateModified > s.n.DateModified {
+					s.n.DateModified = n.DateModified
+				}
+			}
+		}
+	}
+
+	// merge the order of the children
+	children := map[string][]string{}
+	for _, k := range keys {
+		if s := st[k]; s.alive && s.parent != "" {
+			children[s.parent] = append(children[s.parent], k)
+		}
+	}
+	for _, k := range keys {
+		s := st[k]
+		if !s.alive || s.n.Type != NodeTypeFolder {
+			continue
+		}
+		var conflicted bool
+		if children[k], conflicted = mergeOrder(children[k], bt.children[k], ot.children[k], tt.children[k]); conflicted {
+			conflict(k, Conflict{Kind: ConflictOrder})
+		}
+	}
+
+	// build the tree
+	m := &Bookmarks{
+		Roots:            ours.Roots,
+		SyncMetadata:     ours.SyncMetadata,
+		Version:          ours.Version,
+		MetaInfo:         ours.MetaInfo,
+		UnsyncedMetaInfo: ours.UnsyncedMetaInfo,
+		Extra:            ours.Extra,
+	}
+	paths := map[string]string{}
+	var build func(k, path string) BookmarkNode
+	build = func(k, path string) BookmarkNode {
+		paths[k] = path
+		n := st[k].n
+		if n.Children != nil {
+			for _, c := range children[k] {
+				*n.Children = append(*n.Children, st[c].n)
+			}
+			for i, e := range PathElements(*n.Children) {
+				(*n.Children)[i] = build(children[k][i], path+"/"+e)
+			}
+		}
+		return n
+	}
+	for i, r := range m.roots() {
+		*r = build("root:"+string(rootTypes[i]), EscapePathElement(st["root:"+string(rootTypes[i])].n.Name))
+	}
+	for i := range cs {
+		cs[i].GUID, cs[i].Path = st[ck[i]].n.GUID, paths[ck[i]]
+	}
+	m.ReassignIDs()
+	m.UpdateChecksum()
+	return m, cs
+}
+
+type mergeTree struct {
+	nodes    map[string]*mergeEntry
+	children map[string][]string
+	order    []string
+}
+
+type mergeEntry struct {
+	n      *BookmarkNode
+	parent string // the key of the parent, or empty for permanent folders
+	path   string
+}
+
+type mergeState struct {
+	base, ours, theirs *mergeEntry
+	alive              bool
+	parent             string
+	n                  BookmarkNode // without children
+}
+
+// newMergeTree indexes the nodes of b by key. The key is the type of
+// permanent folders, otherwise the GUID, or the ID if the GUID is invalid or
+// was already used.
+func newMergeTree(b *Bookmarks) *mergeTree {
+	t := &mergeTree{
+		nodes:    map[string]*mergeEntry{},
+		children: map[string][]string{},
+	}
+	var walk func(n *BookmarkNode, k, parent, path string)
+	walk = func(n *BookmarkNode, k, parent, path string) {
+		t.nodes[k] = &mergeEntry{n, parent, path}
+		t.order = append(t.order, k)
+		if parent != "" {
+			t.children[parent] = append(t.children[parent], k)
+		}
+		if n.Children != nil {
+			for i, e := range PathElements(*n.Children) {
+				c := &(*n.Children)[i]
+				ck := "id:" + strconv.Itoa(c.ID)
+				if g, err := c.GUID.Canonical(); err == nil && t.nodes["guid:"+g] == nil {
+					ck = "guid:" + g
+				}
+				for x := 1; t.nodes[ck] != nil; x++ {
+					ck = "id:" + strconv.Itoa(c.ID) + "#" + strconv.Itoa(x)
+				}
+				walk(c, ck, k, path+"/"+e)
+			}
+		}
+	}
+	for i, r := range b.roots() {
+		walk(r, "root:"+string(rootTypes[i]), "", EscapePathElement(r.Name))
+	}
+	return t
+}
+
+// changed returns true if the name, url, meta_info, or parent of the node
+// differs between e and x.
+func (e *mergeEntry) changed(x *mergeEntry) bool {
+	if e.parent != x.parent || e.n.Name != x.n.Name || e.n.URL != x.n.URL || len(e.n.MetaInfo) != len(x.n.MetaInfo) {
+		return true
+	}
+	for k, v := range e.n.MetaInfo {
+		if w, ok := x.n.MetaInfo[k]; !ok || v != w {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeOrder orders the merged children of a folder. If only one side changed
+// the relative order of the children present on all sides, that order is used,
+// otherwise ours is. Children which aren't in the chosen order are inserted
+// after the closest preceding sibling from the other side.
+func mergeOrder(merged, base, ours, theirs []string) ([]string, bool) {
+	set := map[string]int{}
+	for _, k := range merged {
+		set[k] |= 1 << 3
+	}
+	for i, s := range [][]string{base, ours, theirs} {
+		for _, k := range s {
+			set[k] |= 1 << i
+		}
+	}
+	filter := func(s []string, mask int) []string {
+		var r []string
+		for _, k := range s {
+			if set[k]&mask == mask {
+				r = append(r, k)
+			}
+		}
+		return r
+	}
+	equal := func(a, b []string) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	bc, oc, tc := filter(base, 0b1111), filter(ours, 0b1111), filter(theirs, 0b1111)
+	primary, secondary := filter(ours, 0b1000), filter(theirs, 0b1000)
+	oChanged, tChanged := !equal(oc, bc), !equal(tc, bc)
+	if !oChanged && tChanged {
+		primary, secondary = secondary, primary
+	}
+
+	r := append([]string(nil), primary...)
+	in := map[string]bool{}
+	for _, k := range r {
+		in[k] = true
+	}
+	insert := func(i int, k string) {
+		r = append(r, "")
+		copy(r[i+1:], r[i:])
+		r[i] = k
+		in[k] = true
+	}
+	for i, k := range secondary {
+		if in[k] {
+			continue
+		}
+		pos := 0
+	prev:
+		for j := i - 1; j >= 0; j-- {
+			for x, y := range r {
+				if y == secondary[j] {
+					pos = x + 1
+					break prev
+				}
+			}
+		}
+		insert(pos, k)
+	}
+	for _, k := range merged {
+		if !in[k] {
+			insert(len(r), k)
+		}
+	}
+	return r, oChanged && tChanged && !equal(oc, tc)
+}
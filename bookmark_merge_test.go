@@ -0,0 +1,279 @@
+package crb
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		ours      func(b *Bookmarks)
+		theirs    func(b *Bookmarks)
+		tree      string
+		conflicts []Conflict
+	}{
+		{
+			name:   "unchanged",
+			ours:   func(b *Bookmarks) {},
+			theirs: func(b *Bookmarks) {},
+			tree:   "A(a1 a2 a3) B(b1) | ",
+		},
+		{
+			name: "rename and move",
+			ours: func(b *Bookmarks) {
+				b.Rename(mergeTestNode(b, "a1"), "x")
+			},
+			theirs: func(b *Bookmarks) {
+				b.Move(mergeTestNode(b, "a1"), mergeTestNode(b, "B"), -1)
+			},
+			tree: "A(a2 a3) B(b1 x) | ",
+		},
+		{
+			name: "move and rename",
+			ours: func(b *Bookmarks) {
+				b.Move(mergeTestNode(b, "a1"), &b.Roots.Other, -1)
+			},
+			theirs: func(b *Bookmarks) {
+				b.Rename(mergeTestNode(b, "a1"), "x")
+			},
+			tree: "A(a2 a3) B(b1) | x",
+		},
+		{
+			name: "rename both",
+			ours: func(b *Bookmarks) {
+				b.Rename(mergeTestNode(b, "a1"), "x")
+			},
+			theirs: func(b *Bookmarks) {
+				b.Rename(mergeTestNode(b, "a1"), "y")
+			},
+			tree: "A(x a2 a3) B(b1) | ",
+			conflicts: []Conflict{
+				{Kind: ConflictField, GUID: mergeTestGUID("a1"), Path: "Bookmarks bar/A/x", Field: "name", Base: "a1", Ours: "x", Theirs: "y"},
+			},
+		},
+		{
+			name: "move both",
+			ours: func(b *Bookmarks) {
+				b.Move(mergeTestNode(b, "a1"), mergeTestNode(b, "B"), -1)
+			},
+			theirs: func(b *Bookmarks) {
+				b.Move(mergeTestNode(b, "a1"), &b.Roots.Other, -1)
+			},
+			tree: "A(a2 a3) B(b1 a1) | ",
+			conflicts: []Conflict{
+				{Kind: ConflictMove, GUID: mergeTestGUID("a1"), Path: "Bookmarks bar/B/a1", Ours: "Bookmarks bar/B", Theirs: "Other bookmarks"},
+			},
+		},
+		{
+			name: "reorder one side",
+			ours: func(b *Bookmarks) {},
+			theirs: func(b *Bookmarks) {
+				b.Move(mergeTestNode(b, "a3"), mergeTestNode(b, "A"), 0)
+			},
+			tree: "A(a3 a1 a2) B(b1) | ",
+		},
+		{
+			name: "reorder both same",
+			ours: func(b *Bookmarks) {
+				b.Move(mergeTestNode(b, "a3"), mergeTestNode(b, "A"), 0)
+			},
+			theirs: func(b *Bookmarks) {
+				b.Move(mergeTestNode(b, "a3"), mergeTestNode(b, "A"), 0)
+			},
+			tree: "A(a3 a1 a2) B(b1) | ",
+		},
+		{
+			name: "reorder both differently",
+			ours: func(b *Bookmarks) {
+				b.Move(mergeTestNode(b, "a1"), mergeTestNode(b, "A"), 1)
+			},
+			theirs: func(b *Bookmarks) {
+				b.Move(mergeTestNode(b, "a3"), mergeTestNode(b, "A"), 0)
+			},
+			tree: "A(a2 a1 a3) B(b1) | ",
+			conflicts: []Conflict{
+				{Kind: ConflictOrder, GUID: mergeTestGUID("A"), Path: "Bookmarks bar/A"},
+			},
+		},
+		{
+			name: "reorder and add",
+			ours: func(b *Bookmarks) {
+				b.InsertAt(mergeTestNode(b, "A"), 1, mergeTestURL("a4"))
+			},
+			theirs: func(b *Bookmarks) {
+				b.Move(mergeTestNode(b, "a3"), mergeTestNode(b, "A"), 0)
+			},
+			tree: "A(a3 a1 a4 a2) B(b1) | ",
+		},
+		{
+			name: "delete folder and add child",
+			ours: func(b *Bookmarks) {
+				b.Remove(mergeTestNode(b, "B"))
+			},
+			theirs: func(b *Bookmarks) {
+				b.InsertAt(mergeTestNode(b, "B"), -1, mergeTestURL("b2"))
+			},
+			tree: "A(a1 a2 a3) B(b2) | ",
+			conflicts: []Conflict{
+				{Kind: ConflictDelete, GUID: mergeTestGUID("B"), Path: "Bookmarks bar/B", Side: "ours"},
+			},
+		},
+		{
+			name: "add child and delete folder",
+			ours: func(b *Bookmarks) {
+				b.InsertAt(mergeTestNode(b, "B"), -1, mergeTestURL("b2"))
+			},
+			theirs: func(b *Bookmarks) {
+				b.Remove(mergeTestNode(b, "B"))
+			},
+			tree: "A(a1 a2 a3) B(b2) | ",
+			conflicts: []Conflict{
+				{Kind: ConflictDelete, GUID: mergeTestGUID("B"), Path: "Bookmarks bar/B", Side: "theirs"},
+			},
+		},
+		{
+			name: "delete and rename",
+			ours: func(b *Bookmarks) {
+				b.Remove(mergeTestNode(b, "b1"))
+			},
+			theirs: func(b *Bookmarks) {
+				b.Rename(mergeTestNode(b, "b1"), "x")
+			},
+			tree: "A(a1 a2 a3) B(x) | ",
+			conflicts: []Conflict{
+				{Kind: ConflictDelete, GUID: mergeTestGUID("b1"), Path: "Bookmarks bar/B/x", Side: "ours"},
+			},
+		},
+		{
+			name: "delete both",
+			ours: func(b *Bookmarks) {
+				b.Remove(mergeTestNode(b, "B"))
+			},
+			theirs: func(b *Bookmarks) {
+				b.Remove(mergeTestNode(b, "b1"))
+			},
+			tree: "A(a1 a2 a3) | ",
+		},
+		{
+			name: "cross move cycle",
+			ours: func(b *Bookmarks) {
+				b.Move(mergeTestNode(b, "A"), mergeTestNode(b, "B"), -1)
+			},
+			theirs: func(b *Bookmarks) {
+				b.Move(mergeTestNode(b, "B"), mergeTestNode(b, "A"), -1)
+			},
+			tree: "B(b1 A(a1 a2 a3)) | ",
+			conflicts: []Conflict{
+				{Kind: ConflictCycle, GUID: mergeTestGUID("B"), Path: "Bookmarks bar/B"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			base := mergeTestBase()
+			ours, theirs := mergeTestClone(base), mergeTestClone(base)
+			tc.ours(ours)
+			tc.theirs(theirs)
+
+			m, cs := Merge(base, ours, theirs)
+			if act := mergeTestTree(m); act != tc.tree {
+				t.Errorf("tree: got %q, expected %q", act, tc.tree)
+			}
+			if act, exp := fmt.Sprintf("%+v", cs), fmt.Sprintf("%+v", tc.conflicts); act != exp {
+				t.Errorf("conflicts:\ngot      %s\nexpected %s", act, exp)
+			}
+			for _, p := range m.Validate() {
+				if p.Severity == SeverityError {
+					t.Errorf("merged tree: %s", p)
+				}
+			}
+		})
+	}
+}
+
+// mergeTestBase returns the tree "A(a1 a2 a3) B(b1) | " (see mergeTestTree).
+func mergeTestBase() *Bookmarks {
+	b := &Bookmarks{Version: CurrentVersion}
+	b.Roots.BookmarkBar = importRoot("Bookmarks bar", BookmarkBarGUID, 0)
+	b.Roots.Other = importRoot("Other bookmarks", OtherBookmarksGUID, 0)
+	b.Roots.MobileBookmark = importRoot("Mobile bookmarks", MobileBookmarksGUID, 0)
+	for _, f := range []struct {
+		name string
+		urls []string
+	}{
+		{"A", []string{"a1", "a2", "a3"}},
+		{"B", []string{"b1"}},
+	} {
+		cs := []BookmarkNode{}
+		for _, u := range f.urls {
+			cs = append(cs, mergeTestURL(u))
+		}
+		*b.Roots.BookmarkBar.Children = append(*b.Roots.BookmarkBar.Children, BookmarkNode{
+			GUID:     mergeTestGUID(f.name),
+			Type:     NodeTypeFolder,
+			Name:     f.name,
+			Children: &cs,
+		})
+	}
+	b.ReassignIDs()
+	b.UpdateChecksum()
+	return b
+}
+
+// mergeTestURL returns a bookmark named name with a GUID derived from it.
+func mergeTestURL(name string) BookmarkNode {
+	return BookmarkNode{
+		GUID: mergeTestGUID(name),
+		Type: NodeTypeURL,
+		Name: name,
+		URL:  "https://example.com/" + name,
+	}
+}
+
+// mergeTestGUID returns a GUID derived from name.
+func mergeTestGUID(name string) GUID {
+	x := fmt.Sprintf("%x", name)
+	return GUID("00000000-0000-4000-8000-" + strings.Repeat("0", 12-len(x)) + x)
+}
+
+// mergeTestNode finds the node with the GUID derived from name.
+func mergeTestNode(b *Bookmarks, name string) *BookmarkNode {
+	n := b.FindByGUID(mergeTestGUID(name))
+	if n == nil {
+		panic("no node " + name)
+	}
+	return n
+}
+
+// mergeTestClone deep-copies b.
+func mergeTestClone(b *Bookmarks) *Bookmarks {
+	buf, err := json.Marshal(b)
+	if err != nil {
+		panic(err)
+	}
+	var c Bookmarks
+	if err := json.Unmarshal(buf, &c); err != nil {
+		panic(err)
+	}
+	return &c
+}
+
+// mergeTestTree formats the children of the bookmarks bar and other bookmarks
+// like "A(a1 a2) B(b1) | c1".
+func mergeTestTree(b *Bookmarks) string {
+	var format func(ns []BookmarkNode) string
+	format = func(ns []BookmarkNode) string {
+		var s []string
+		for _, n := range ns {
+			if n.Type == NodeTypeFolder {
+				s = append(s, n.Name+"("+format(*n.Children)+")")
+			} else {
+				s = append(s, n.Name)
+			}
+		}
+		return strings.Join(s, " ")
+	}
+	return format(*b.Roots.BookmarkBar.Children) + " | " + format(*b.Roots.Other.Children)
+}
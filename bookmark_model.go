@@ -0,0 +1,410 @@
+package crb
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"time"
+)
+
+// Note: Pointers to nodes are only valid until the children of their parent
+// are modified. Mutations update the date modified of folders like Chrome's
+// BookmarkModel.
+//
+// See:
+//   - https://source.chromium.org/chromium/chromium/src/+/main:components/bookmarks/browser/bookmark_model.cc;drc=aabc28688acc0ba19b42ac3795febddc11a43ede
+
+// roots returns the permanent folders of b.
+func (b *Bookmarks) roots() [3]*BookmarkNode {
+	return [3]*BookmarkNode{
+		&b.Roots.BookmarkBar,
+		&b.Roots.Other,
+		&b.Roots.MobileBookmark,
+	}
+}
+
+// IsRoot returns true if n is one of the permanent folders of b.
+func (b *Bookmarks) IsRoot(n *BookmarkNode) bool {
+	for _, r := range b.roots() {
+		if n == r {
+			return true
+		}
+	}
+	return false
+}
+
+// find returns the first node for which fn returns true, and its parent (nil
+// for the permanent folders).
+func (b *Bookmarks) find(fn func(n *BookmarkNode) bool) (n, parent *BookmarkNode) {
+	for _, r := range b.roots() {
+		if fn(r) {
+			return r, nil
+		}
+		if n, parent = r.find(fn); n != nil {
+			return n, parent
+		}
+	}
+	return nil, nil
+}
+
+func (n *BookmarkNode) find(fn func(n *BookmarkNode) bool) (*BookmarkNode, *BookmarkNode) {
+	if n.Children != nil {
+		for i := range *n.Children {
+			c := &(*n.Children)[i]
+			if fn(c) {
+				return c, n
+			}
+			if x, p := c.find(fn); x != nil {
+				return x, p
+			}
+		}
+	}
+	return nil, nil
+}
+
+// FindByID returns the first node with the specified ID, or nil.
+func (b *Bookmarks) FindByID(id int) *BookmarkNode {
+	n, _ := b.find(func(n *BookmarkNode) bool {
+		return n.ID == id
+	})
+	return n
+}
+
+// FindByGUID returns the first node with the specified GUID (compared
+// case-insensitively), or nil.
+func (b *Bookmarks) FindByGUID(guid GUID) *BookmarkNode {
+	n, _ := b.find(func(n *BookmarkNode) bool {
+		return n.GUID.Equal(guid)
+	})
+	return n
+}
+
+// Parent returns the parent folder of n, or nil if n is a permanent folder or
+// is not in b.
+func (b *Bookmarks) Parent(n *BookmarkNode) *BookmarkNode {
+	_, p := b.find(func(x *BookmarkNode) bool {
+		return x == n
+	})
+	return p
+}
+
+// Index returns the index of n in its parent's children, or -1.
+func (b *Bookmarks) Index(n *BookmarkNode) int {
+	if p := b.Parent(n); p != nil {
+		for i := range *p.Children {
+			if &(*p.Children)[i] == n {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// contains returns true if x is n or one of its descendants.
+func (n *BookmarkNode) contains(x *BookmarkNode) bool {
+	if n == x {
+		return true
+	}
+	c, _ := n.find(func(c *BookmarkNode) bool {
+		return c == x
+	})
+	return c != nil
+}
+
+// InsertAt inserts a copy of n into parent at the specified index (-1 to
+// append), returning a pointer to the inserted node. If the ID of n or any of
+// its descendants is zero, a new one is allocated. It is an error for n or its
+// descendants to have IDs which are already in use.
+func (b *Bookmarks) InsertAt(parent *BookmarkNode, index int, n BookmarkNode) (*BookmarkNode, error) {
+	if parent == nil || parent.Type != NodeTypeFolder {
+		return nil, fmt.Errorf("parent is not a folder")
+	}
+	if !b.IsRoot(parent) && b.Parent(parent) == nil {
+		return nil, fmt.Errorf("parent is not in bookmarks")
+	}
+	if err := n.Type.Valid(); err != nil {
+		return nil, err
+	}
+
+	n = n.clone()
+	used := b.ids()
+	var err error
+	n.Walk(func(c BookmarkNode, parents ...string) error {
+		if c.ID != 0 && used[c.ID] != 0 {
+			err = fmt.Errorf("id %d is already in use", c.ID)
+			return ErrBreak
+		}
+		used[c.ID]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if used[0] != 0 {
+		a := NewIDAllocator(b)
+		n.assignIDs(a)
+	}
+	return b.insertAt(parent, index, n)
+}
+
+// clone deep-copies n.
+func (n BookmarkNode) clone() BookmarkNode {
+	n.MetaInfo = maps.Clone(n.MetaInfo)
+	n.UnsyncedMetaInfo = maps.Clone(n.UnsyncedMetaInfo)
+	n.Extra = maps.Clone(n.Extra)
+	if n.Children != nil {
+		cs := make([]BookmarkNode, len(*n.Children))
+		for i, c := range *n.Children {
+			cs[i] = c.clone()
+		}
+		n.Children = &cs
+	}
+	return n
+}
+
+func (b *Bookmarks) insertAt(parent *BookmarkNode, index int, n BookmarkNode) (*BookmarkNode, error) {
+	if n.Type == NodeTypeFolder && n.Children == nil {
+		n.Children = new([]BookmarkNode)
+	}
+	if parent.Children == nil {
+		parent.Children = new([]BookmarkNode)
+	}
+	if index < 0 || index > len(*parent.Children) {
+		if index != -1 {
+			return nil, fmt.Errorf("index %d out of range", index)
+		}
+		index = len(*parent.Children)
+	}
+	*parent.Children = append(*parent.Children, BookmarkNode{})
+	copy((*parent.Children)[index+1:], (*parent.Children)[index:])
+	(*parent.Children)[index] = n
+	parent.touch()
+	return &(*parent.Children)[index], nil
+}
+
+// Remove removes n and its descendants. It cannot be a permanent folder.
+func (b *Bookmarks) Remove(n *BookmarkNode) error {
+	if b.IsRoot(n) {
+		return fmt.Errorf("cannot remove permanent folder")
+	}
+	p := b.Parent(n)
+	if p == nil {
+		return fmt.Errorf("node is not in bookmarks")
+	}
+	removeChild(p.Children, n)
+	return nil
+}
+
+// Move moves n to the specified index in parent (-1 to append), returning the
+// new pointer to n. The index is interpreted after n is removed from its
+// current parent.
+func (b *Bookmarks) Move(n, parent *BookmarkNode, index int) (*BookmarkNode, error) {
+	if b.IsRoot(n) {
+		return nil, fmt.Errorf("cannot move permanent folder")
+	}
+	if parent == nil || parent.Type != NodeTypeFolder {
+		return nil, fmt.Errorf("parent is not a folder")
+	}
+	if n.contains(parent) {
+		return nil, fmt.Errorf("cannot move folder into itself")
+	}
+	p := b.Parent(n)
+	if p == nil {
+		return nil, fmt.Errorf("node is not in bookmarks")
+	}
+	if p != parent {
+		// note: the old parent's children pointer remains valid even if p
+		// itself is moved by the insertion since parent isn't a descendant
+		// of n
+		if !b.IsRoot(parent) && b.Parent(parent) == nil {
+			return nil, fmt.Errorf("parent is not in bookmarks")
+		}
+		pc := p.Children
+		c, err := b.insertAt(parent, index, *n)
+		if err != nil {
+			return nil, err
+		}
+		removeChild(pc, n)
+		return c, nil
+	}
+	if index < -1 || index > len(*p.Children)-1 {
+		return nil, fmt.Errorf("index %d out of range", index)
+	}
+	x := removeChild(p.Children, n)
+	if index == -1 {
+		index = len(*p.Children)
+	}
+	*p.Children = append(*p.Children, BookmarkNode{})
+	copy((*p.Children)[index+1:], (*p.Children)[index:])
+	(*p.Children)[index] = x
+	p.touch()
+	return &(*p.Children)[index], nil
+}
+
+// removeChild removes n from children, returning it.
+func removeChild(children *[]BookmarkNode, n *BookmarkNode) BookmarkNode {
+	for i := range *children {
+		if &(*children)[i] == n {
+			x := *n
+			*children = append((*children)[:i], (*children)[i+1:]...)
+			return x
+		}
+	}
+	panic("crb: node is not a child")
+}
+
+// MaxID returns the largest node ID in b.
+func (b *Bookmarks) MaxID() int {
+	var max int
+	b.Walk(func(n BookmarkNode, parents ...string) error {
+		if n.ID > max {
+			max = n.ID
+		}
+		return nil
+	})
+	return max
+}
+
+// ids returns the number of times each ID is used in b.
+func (b *Bookmarks) ids() map[int]int {
+	m := map[int]int{}
+	b.Walk(func(n BookmarkNode, parents ...string) error {
+		m[n.ID]++
+		return nil
+	})
+	return m
+}
+
+// IDAllocator allocates IDs for new nodes like BookmarkModel. It does not
+// check IDs which were added after it was created.
+type IDAllocator struct {
+	next int
+}
+
+// NewIDAllocator creates a new IDAllocator which allocates IDs after the
+// largest one in b.
+func NewIDAllocator(b *Bookmarks) *IDAllocator {
+	return &IDAllocator{b.MaxID() + 1}
+}
+
+// Next returns the next unused ID.
+func (a *IDAllocator) Next() int {
+	id := a.next
+	a.next++
+	return id
+}
+
+// assignIDs allocates IDs for n and its descendants which don't have one.
+func (n *BookmarkNode) assignIDs(a *IDAllocator) {
+	if n.ID == 0 {
+		n.ID = a.Next()
+	}
+	if n.Children != nil {
+		for i := range *n.Children {
+			(*n.Children)[i].assignIDs(a)
+		}
+	}
+}
+
+// ReassignIDs renumbers all nodes depth-first starting at 1, like Chrome does
+// when it finds duplicate or invalid IDs. The checksum is not updated.
+func (b *Bookmarks) ReassignIDs() {
+	a := &IDAllocator{1}
+	for _, r := range b.roots() {
+		r.reassignIDs(a)
+	}
+}
+
+func (n *BookmarkNode) reassignIDs(a *IDAllocator) {
+	n.ID = a.Next()
+	if n.Children != nil {
+		for i := range *n.Children {
+			(*n.Children)[i].reassignIDs(a)
+		}
+	}
+}
+
+// DuplicateID is a node ID used by more than one node.
+type DuplicateID struct {
+	ID    int
+	Nodes []*BookmarkNode
+}
+
+// DuplicateIDs finds IDs used by more than one node in b, which would cause
+// Chrome to reassign all IDs when loading it.
+func (b *Bookmarks) DuplicateIDs() []DuplicateID {
+	m := map[int][]*BookmarkNode{}
+	var ids []int
+	b.find(func(n *BookmarkNode) bool {
+		if _, ok := m[n.ID]; !ok {
+			ids = append(ids, n.ID)
+		}
+		m[n.ID] = append(m[n.ID], n)
+		return false
+	})
+	var dup []DuplicateID
+	for _, id := range ids {
+		if ns := m[id]; len(ns) > 1 {
+			dup = append(dup, DuplicateID{id, ns})
+		}
+	}
+	return dup
+}
+
+// ValidateGUIDs checks that the permanent folders have the correct GUIDs and
+// that no other node uses one of them.
+func (b *Bookmarks) ValidateGUIDs() []error {
+	var errs []error
+	b.guidProblems(func(n *BookmarkNode, msg string) {
+		if b.IsRoot(n) {
+			errs = append(errs, fmt.Errorf("permanent folder %q %s", n.Name, msg))
+		} else {
+			errs = append(errs, fmt.Errorf("node %d (%q) %s", n.ID, n.Name, msg))
+		}
+	})
+	return errs
+}
+
+func (b *Bookmarks) guidProblems(fn func(n *BookmarkNode, msg string)) {
+	for i, r := range b.roots() {
+		if g := permanentGUIDs[i]; !r.GUID.Equal(g) {
+			fn(r, fmt.Sprintf("has guid %q, expected %q", string(r.GUID), string(g)))
+		}
+	}
+	b.find(func(n *BookmarkNode) bool {
+		if !b.IsRoot(n) {
+			for _, g := range permanentGUIDs {
+				if n.GUID.Equal(g) {
+					fn(n, fmt.Sprintf("uses permanent folder guid %q", string(g)))
+				}
+			}
+		}
+		return false
+	})
+}
+
+// permanentGUIDs are the GUIDs of the nodes returned by roots, plus the root
+// node.
+var permanentGUIDs = [...]GUID{BookmarkBarGUID, OtherBookmarksGUID, MobileBookmarksGUID, RootNodeGUID}
+
+// Rename sets the title of n.
+func (b *Bookmarks) Rename(n *BookmarkNode, name string) {
+	n.Name = name
+}
+
+// SetURL sets the URL of the bookmark n.
+func (b *Bookmarks) SetURL(n *BookmarkNode, u string) error {
+	if n.Type != NodeTypeURL {
+		return fmt.Errorf("node is not a url")
+	}
+	if _, err := url.Parse(u); err != nil {
+		return err
+	}
+	n.URL = u
+	return nil
+}
+
+// touch updates the date modified of the folder n.
+func (n *BookmarkNode) touch() {
+	n.DateModified.SetTime(time.Now())
+}
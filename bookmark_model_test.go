@@ -0,0 +1,144 @@
+package crb
+
+import "testing"
+
+func TestMove(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		node   string
+		parent string // empty for other bookmarks, "bar" for the bookmarks bar
+		index  int
+		tree   string // empty if it should fail
+	}{
+		{"append", "a1", "A", -1, "A(a2 a3 a1) B(b1) | "},
+		{"first", "a3", "A", 0, "A(a3 a1 a2) B(b1) | "},
+		{"same index", "a2", "A", 1, "A(a1 a2 a3) B(b1) | "},
+		{"last", "a1", "A", 2, "A(a2 a3 a1) B(b1) | "},
+		{"after removal", "a1", "A", 3, ""}, // only 2 children after it's removed
+		{"negative", "a1", "A", -2, ""},
+		{"other folder", "a1", "B", 0, "A(a2 a3) B(a1 b1) | "},
+		{"other folder append", "a1", "B", -1, "A(a2 a3) B(b1 a1) | "},
+		{"other folder end", "a1", "B", 1, "A(a2 a3) B(b1 a1) | "},
+		{"other folder out of range", "a1", "B", 2, ""},
+		{"other root", "a2", "", -1, "A(a1 a3) B(b1) | a2"},
+		{"folder", "A", "B", 0, "B(A(a1 a2 a3) b1) | "},
+		{"folder into itself", "A", "A", -1, ""},
+		{"into bookmark", "a1", "b1", -1, ""},
+		{"up", "a1", "bar", 0, "a1 A(a2 a3) B(b1) | "},
+		{"up append", "a1", "bar", -1, "A(a2 a3) B(b1) a1 | "},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := mergeTestBase()
+			var parent *BookmarkNode
+			switch tc.parent {
+			case "":
+				parent = &b.Roots.Other
+			case "bar":
+				parent = &b.Roots.BookmarkBar
+			default:
+				parent = mergeTestNode(b, tc.parent)
+			}
+			n, err := b.Move(mergeTestNode(b, tc.node), parent, tc.index)
+			if tc.tree == "" {
+				if err == nil {
+					t.Errorf("expected error, got %q", mergeTestTree(b))
+				} else if act := mergeTestTree(b); act != mergeTestTree(mergeTestBase()) {
+					t.Errorf("tree modified on error: %q", act)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("move: %v", err)
+			}
+			if act := mergeTestTree(b); act != tc.tree {
+				t.Errorf("got %q, expected %q", act, tc.tree)
+			}
+			if n.GUID != mergeTestGUID(tc.node) || b.FindByGUID(n.GUID) != n {
+				t.Errorf("returned pointer is not to the moved node")
+			}
+		})
+	}
+}
+
+func TestMoveDescendant(t *testing.T) {
+	b := mergeTestBase()
+	a := mergeTestNode(b, "A")
+	c, err := b.InsertAt(a, -1, BookmarkNode{Type: NodeTypeFolder, Name: "C", GUID: mergeTestGUID("C")})
+	if err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if _, err := b.InsertAt(c, -1, BookmarkNode{Type: NodeTypeFolder, Name: "D", GUID: mergeTestGUID("D")}); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	for _, x := range []string{"C", "D"} {
+		if _, err := b.Move(mergeTestNode(b, "A"), mergeTestNode(b, x), -1); err == nil {
+			t.Errorf("moving A into %s: expected error", x)
+		}
+	}
+	if _, err := b.Move(mergeTestNode(b, "C"), mergeTestNode(b, "D"), -1); err == nil {
+		t.Errorf("moving C into D: expected error")
+	}
+	if act, exp := mergeTestTree(b), "A(a1 a2 a3 C(D())) B(b1) | "; act != exp {
+		t.Errorf("got %q, expected %q", act, exp)
+	}
+	if _, err := b.Move(&b.Roots.Other, mergeTestNode(b, "D"), -1); err == nil {
+		t.Errorf("moving a permanent folder: expected error")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	b := mergeTestBase()
+	if err := b.Remove(mergeTestNode(b, "a2")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := b.Remove(mergeTestNode(b, "B")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if act, exp := mergeTestTree(b), "A(a1 a3) | "; act != exp {
+		t.Errorf("got %q, expected %q", act, exp)
+	}
+	if b.FindByGUID(mergeTestGUID("b1")) != nil {
+		t.Errorf("descendant of removed folder is still in bookmarks")
+	}
+	if err := b.Remove(&b.Roots.Other); err == nil {
+		t.Errorf("removing a permanent folder: expected error")
+	}
+	if err := b.Remove(&BookmarkNode{}); err == nil {
+		t.Errorf("removing a node not in bookmarks: expected error")
+	}
+}
+
+func TestInsertAtCopy(t *testing.T) {
+	b := mergeTestBase()
+	cs := []BookmarkNode{mergeTestURL("c1"), mergeTestURL("c2")}
+	n := BookmarkNode{
+		Type:     NodeTypeFolder,
+		Name:     "C",
+		GUID:     mergeTestGUID("C"),
+		Children: &cs,
+		MetaInfo: map[string]string{"k": "v"},
+	}
+	x, err := b.InsertAt(&b.Roots.Other, -1, n)
+	if err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if cs[0].ID != 0 || cs[1].ID != 0 {
+		t.Errorf("ids assigned to the caller's children")
+	}
+	if (*x.Children)[0].ID == 0 || (*x.Children)[1].ID == 0 {
+		t.Errorf("ids not assigned to the inserted children")
+	}
+	x.MetaInfo["k"] = "x"
+	(*x.Children)[0].Name = "x"
+	if n.MetaInfo["k"] != "v" || cs[0].Name != "c1" {
+		t.Errorf("inserted node shares data with the caller's node")
+	}
+
+	// the same node can be inserted again
+	if _, err := b.InsertAt(&b.Roots.Other, -1, n); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if len(b.DuplicateIDs()) != 0 {
+		t.Errorf("duplicate ids after inserting twice")
+	}
+}
@@ -0,0 +1,262 @@
+package crb
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Paths address nodes by the names of the node and its ancestors (including
+// the permanent folder), separated by slashes (e.g., "Bookmarks bar/Work/Jira").
+//
+// Within a path element, a backslash escapes the next character. If multiple
+// siblings have the same name, an unescaped "[n]" suffix selects the nth one
+// (starting at 1) with that name. Lookup and Glob also accept the keys of the
+// permanent folders in the bookmarks file (e.g., "bookmark_bar").
+//
+// Glob patterns are paths where each element is a pattern as accepted by
+// path.Match, or "**" to match zero or more elements.
+
+// EscapePathElement escapes a name for use as an element of a path or glob
+// pattern.
+func EscapePathElement(name string) string {
+	if !strings.ContainsAny(name, `\/[]*?`) {
+		return name
+	}
+	var b strings.Builder
+	for _, c := range name {
+		switch c {
+		case '\\', '/', '[', ']', '*', '?':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// JoinPath escapes and joins names into a path.
+func JoinPath(names ...string) string {
+	e := make([]string, len(names))
+	for i, n := range names {
+		e[i] = EscapePathElement(n)
+	}
+	return strings.Join(e, "/")
+}
+
+// splitPath splits p at unescaped slashes, ignoring empty elements.
+func splitPath(p string) []string {
+	var e []string
+	var esc bool
+	var last int
+	for i, c := range p {
+		switch {
+		case esc:
+			esc = false
+		case c == '\\':
+			esc = true
+		case c == '/':
+			if i != last {
+				e = append(e, p[last:i])
+			}
+			last = i + 1
+		}
+	}
+	if last != len(p) {
+		e = append(e, p[last:])
+	}
+	return e
+}
+
+// parsePathElement unescapes a path element and parses the sibling index
+// suffix, if any (otherwise 0).
+func parsePathElement(e string) (name string, index int) {
+	var r []rune
+	var esc []bool
+	var escaped bool
+	for _, c := range e {
+		if !escaped && c == '\\' {
+			escaped = true
+			continue
+		}
+		r = append(r, c)
+		esc = append(esc, escaped)
+		escaped = false
+	}
+	if n := len(r); n > 2 && r[n-1] == ']' && !esc[n-1] {
+		for i := n - 2; i >= 0 && !esc[i]; i-- {
+			if r[i] == '[' {
+				if v, err := strconv.Atoi(string(r[i+1 : n-1])); err == nil && v > 0 {
+					return string(r[:i]), v
+				}
+				break
+			}
+			if r[i] < '0' || r[i] > '9' {
+				break
+			}
+		}
+	}
+	return string(r), 0
+}
+
+// PathElements returns the path elements for the children of a folder.
+func PathElements(children []BookmarkNode) []string {
+	count := make(map[string]int, len(children))
+	for _, c := range children {
+		count[c.Name]++
+	}
+	seen := make(map[string]int, len(count))
+	e := make([]string, len(children))
+	for i, c := range children {
+		e[i] = EscapePathElement(c.Name)
+		if count[c.Name] > 1 {
+			seen[c.Name]++
+			e[i] += "[" + strconv.Itoa(seen[c.Name]) + "]"
+		}
+	}
+	return e
+}
+
+// Path returns the path of n, or an empty string if it is not in b.
+func (b *Bookmarks) Path(n *BookmarkNode) string {
+	var p string
+	b.walkPath(func(x *BookmarkNode, path []string) {
+		if x == n && p == "" {
+			p = strings.Join(path, "/")
+		}
+	})
+	return p
+}
+
+// Lookup returns the node at the specified path.
+func (b *Bookmarks) Lookup(p string) (*BookmarkNode, error) {
+	e := splitPath(p)
+	if len(e) == 0 {
+		return nil, fmt.Errorf("lookup %q: empty path", p)
+	}
+
+	var n *BookmarkNode
+	rn, _ := parsePathElement(e[0])
+	for i, r := range b.roots() {
+		if r.Name == rn || string(rootTypes[i]) == rn {
+			n = r
+			break
+		}
+	}
+	if n == nil {
+		return nil, fmt.Errorf("lookup %q: no permanent folder named %q", p, rn)
+	}
+
+	for i := 1; i < len(e); i++ {
+		name, index := parsePathElement(e[i])
+		if n.Children == nil {
+			return nil, fmt.Errorf("lookup %q: %q is not a folder", p, strings.Join(e[:i], "/"))
+		}
+		var match []*BookmarkNode
+		for j := range *n.Children {
+			if c := &(*n.Children)[j]; c.Name == name {
+				match = append(match, c)
+			}
+		}
+		switch {
+		case len(match) == 0:
+			return nil, fmt.Errorf("lookup %q: %q not found", p, strings.Join(e[:i+1], "/"))
+		case index > len(match):
+			return nil, fmt.Errorf("lookup %q: %q only has %d nodes named %q", p, strings.Join(e[:i], "/"), len(match), name)
+		case index != 0:
+			n = match[index-1]
+		case len(match) > 1:
+			return nil, fmt.Errorf("lookup %q: %q has %d nodes named %q (use [n] to select one)", p, strings.Join(e[:i], "/"), len(match), name)
+		default:
+			n = match[0]
+		}
+	}
+	return n, nil
+}
+
+// Glob returns the nodes with paths matching pattern in tree order. The only
+// possible error is path.ErrBadPattern.
+func (b *Bookmarks) Glob(pattern string) ([]*BookmarkNode, error) {
+	ns, _, err := b.GlobPaths(pattern)
+	return ns, err
+}
+
+// GlobPaths is like Glob, but also returns the path of each node.
+func (b *Bookmarks) GlobPaths(pattern string) ([]*BookmarkNode, []string, error) {
+	e := splitPath(pattern)
+	if err := checkPattern(e); err != nil {
+		return nil, nil, err
+	}
+	var (
+		ns    []*BookmarkNode
+		ps    []string
+		names []string
+		path  []string
+		key   string
+	)
+	var walk func(n *BookmarkNode, pe string)
+	walk = func(n *BookmarkNode, pe string) {
+		names, path = append(names, n.Name), append(path, pe)
+		ok := matchPath(e, names)
+		if name := names[0]; !ok {
+			names[0] = key
+			ok = matchPath(e, names)
+			names[0] = name
+		}
+		if ok {
+			ns, ps = append(ns, n), append(ps, strings.Join(path, "/"))
+		}
+		if n.Children != nil {
+			for i, pe := range PathElements(*n.Children) {
+				walk(&(*n.Children)[i], pe)
+			}
+		}
+		names, path = names[:len(names)-1], path[:len(path)-1]
+	}
+	for i, r := range b.roots() {
+		key = string(rootTypes[i])
+		walk(r, EscapePathElement(r.Name))
+	}
+	return ns, ps, nil
+}
+
+// MatchPath reports whether the unescaped names of a node and its ancestors
+// (including the permanent folder) match the glob pattern. The only possible
+// error is path.ErrBadPattern.
+func MatchPath(pattern string, names []string) (bool, error) {
+	e := splitPath(pattern)
+	if err := checkPattern(e); err != nil {
+		return false, err
+	}
+	return matchPath(e, names), nil
+}
+
+func checkPattern(e []string) error {
+	for _, x := range e {
+		if _, err := path.Match(x, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func matchPath(e []string, names []string) bool {
+	if len(e) == 0 {
+		return len(names) == 0
+	}
+	if e[0] == "**" {
+		for i := 0; i <= len(names); i++ {
+			if matchPath(e[1:], names[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(names) == 0 {
+		return false
+	}
+	// path.Match won't match slashes with wildcards, so replace them with
+	// something which won't be in a name
+	ok, _ := path.Match(strings.ReplaceAll(e[0], `\/`, "\\\x00"), strings.ReplaceAll(names[0], "/", "\x00"))
+	return ok && matchPath(e[1:], names[1:])
+}
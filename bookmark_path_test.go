@@ -0,0 +1,45 @@
+package crb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGlob(t *testing.T) {
+	b := mergeTestBase()
+	b.InsertAt(mergeTestNode(b, "B"), -1, BookmarkNode{Type: NodeTypeURL, Name: "b1", URL: "https://example.com/"})
+	b.InsertAt(mergeTestNode(b, "B"), -1, BookmarkNode{Type: NodeTypeURL, Name: "x/y", URL: "https://example.com/"})
+
+	for _, tc := range []struct {
+		pattern string
+		paths   string
+	}{
+		{"Bookmarks bar/A/*", "Bookmarks bar/A/a1 Bookmarks bar/A/a2 Bookmarks bar/A/a3"},
+		{"bookmark_bar/A/a?", "Bookmarks bar/A/a1 Bookmarks bar/A/a2 Bookmarks bar/A/a3"},
+		{"bookmark_*", "Bookmarks bar"},
+		{"other", "Other bookmarks"},
+		{"synced/**", "Mobile bookmarks"},
+		{"**/b1", "Bookmarks bar/B/b1[1] Bookmarks bar/B/b1[2]"},
+		{"**/x\\/y", "Bookmarks bar/B/x\\/y"},
+		{"*/B", "Bookmarks bar/B"},
+		{"bookmark_bar/**/a3", "Bookmarks bar/A/a3"},
+		{"Other bookmarks/*", ""},
+	} {
+		ns, ps, err := b.GlobPaths(tc.pattern)
+		if err != nil {
+			t.Errorf("glob %q: %v", tc.pattern, err)
+			continue
+		}
+		if act := strings.Join(ps, " "); act != tc.paths {
+			t.Errorf("glob %q: got %q, expected %q", tc.pattern, act, tc.paths)
+		}
+		for i, n := range ns {
+			if x, err := b.Lookup(ps[i]); err != nil || x != n {
+				t.Errorf("glob %q: path %q doesn't refer to the matched node", tc.pattern, ps[i])
+			}
+		}
+	}
+	if _, err := b.Glob("["); err == nil {
+		t.Errorf("expected error for bad pattern")
+	}
+}
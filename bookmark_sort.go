@@ -0,0 +1,160 @@
+package crb
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// SortKey is what to sort nodes by.
+type SortKey string
+
+const (
+	SortByName         SortKey = "name"  // collated for SortOptions.Locale in natural order, ignoring case and accents
+	SortByURL          SortKey = "url"   // ignoring case, folders first (by name)
+	SortByHost         SortKey = "host"  // ignoring www. and case, then by url, folders first (by name)
+	SortByDateAdded    SortKey = "added" // oldest first
+	SortByDateLastUsed SortKey = "used"  // least recently used first
+)
+
+// SortOptions controls how the children of a folder are sorted.
+type SortOptions struct {
+	By           SortKey
+	Reverse      bool     // reverse the order (except for FoldersFirst and Pinned)
+	FoldersFirst bool     // put folders before bookmarks
+	Recursive    bool     // also sort the children of child folders
+	Pinned       []string // path.Match patterns for the names of children to keep at the start, in their existing order
+	Locale       string   // BCP 47 language tag for collating names (e.g., "sv"), or empty for the root locale
+}
+
+// Sort sorts the children of the folder n. Nodes which compare equal keep
+// their existing order. Like Chrome, the date modified isn't updated.
+func (n *BookmarkNode) Sort(o SortOptions) error {
+	tag := language.Und
+	if o.Locale != "" {
+		t, err := language.Parse(o.Locale)
+		if err != nil {
+			return fmt.Errorf("invalid locale %q: %w", o.Locale, err)
+		}
+		tag = t
+	}
+	compareNames := newNameCollator(tag)
+
+	var cmp func(a, b *BookmarkNode) int
+	switch o.By {
+	case SortByName:
+		cmp = func(a, b *BookmarkNode) int {
+			return compareNames(a.Name, b.Name)
+		}
+	case SortByURL, SortByHost:
+		cmp = func(a, b *BookmarkNode) int {
+			if af, bf := a.Type == NodeTypeFolder, b.Type == NodeTypeFolder; af || bf {
+				switch {
+				case af && bf:
+					return compareNames(a.Name, b.Name)
+				case af:
+					return -1
+				default:
+					return 1
+				}
+			}
+			if o.By == SortByHost {
+				if c := strings.Compare(sortHost(a.URL), sortHost(b.URL)); c != 0 {
+					return c
+				}
+			}
+			return strings.Compare(strings.ToLower(a.URL), strings.ToLower(b.URL))
+		}
+	case SortByDateAdded:
+		cmp = func(a, b *BookmarkNode) int {
+			return compareTime(a.DateAdded, b.DateAdded)
+		}
+	case SortByDateLastUsed:
+		cmp = func(a, b *BookmarkNode) int {
+			return compareTime(a.DateLastUsed, b.DateLastUsed)
+		}
+	default:
+		return fmt.Errorf("unknown sort key %q", o.By)
+	}
+	for _, p := range o.Pinned {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid pinned pattern %q: %w", p, err)
+		}
+	}
+	n.sort(o, cmp)
+	return nil
+}
+
+func (n *BookmarkNode) sort(o SortOptions, cmp func(a, b *BookmarkNode) int) {
+	if n.Type != NodeTypeFolder || n.Children == nil {
+		return
+	}
+	pinned := func(x *BookmarkNode) bool {
+		for _, p := range o.Pinned {
+			if ok, _ := path.Match(p, x.Name); ok {
+				return true
+			}
+		}
+		return false
+	}
+	cs := *n.Children
+	sort.SliceStable(cs, func(i, j int) bool {
+		a, b := &cs[i], &cs[j]
+		if ap, bp := pinned(a), pinned(b); ap != bp {
+			return ap
+		} else if ap {
+			return false
+		}
+		if o.FoldersFirst {
+			if af, bf := a.Type == NodeTypeFolder, b.Type == NodeTypeFolder; af != bf {
+				return af
+			}
+		}
+		if o.Reverse {
+			return cmp(a, b) > 0
+		}
+		return cmp(a, b) < 0
+	})
+	if o.Recursive {
+		for i := range cs {
+			cs[i].sort(o, cmp)
+		}
+	}
+}
+
+func compareTime(a, b Time) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// sortHost returns the lowercase host of u without the www. prefix.
+func sortHost(u string) string {
+	x, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(x.Hostname()), "www.")
+}
+
+// newNameCollator returns a func which compares names for the locale in
+// natural order (i.e., numbers are compared by value), ignoring case and
+// accents. Names which are otherwise equal are compared by their code points.
+func newNameCollator(tag language.Tag) func(a, b string) int {
+	c := collate.New(tag, collate.Loose, collate.Numeric)
+	return func(a, b string) int {
+		if x := c.CompareString(a, b); x != 0 {
+			return x
+		}
+		return strings.Compare(a, b)
+	}
+}
@@ -0,0 +1,45 @@
+package crb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSortName(t *testing.T) {
+	for _, tc := range []struct {
+		locale string
+		in     string
+		out    string
+	}{
+		{"", "a10 a2 a1 a02", "a1 a02 a2 a10"},
+		{"", "banana Apple cherry", "Apple banana cherry"},
+		{"", "ezra éclair eat Eclair", "eat Eclair éclair ezra"},
+		{"", "Strasse Straße Strasze Strast", "Strasse Straße Strast Strasze"},
+		{"", "zebra Öl oz", "Öl oz zebra"},
+		{"sv", "zebra Öl oz", "oz zebra Öl"},
+		{"", "γάμμα Alpha βήτα άλφα", "Alpha άλφα βήτα γάμμα"},
+		{"", "Ярослав Борис Андрей", "Андрей Борис Ярослав"},
+		{"", "file٣ file2", "file2 file٣"},
+	} {
+		b := mergeTestBase()
+		f := &b.Roots.Other
+		for _, x := range strings.Fields(tc.in) {
+			if _, err := b.InsertAt(f, -1, BookmarkNode{Type: NodeTypeFolder, Name: x}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := f.Sort(SortOptions{By: SortByName, Locale: tc.locale}); err != nil {
+			t.Fatalf("sort: %v", err)
+		}
+		var act []string
+		for _, c := range *f.Children {
+			act = append(act, c.Name)
+		}
+		if a := strings.Join(act, " "); a != tc.out {
+			t.Errorf("locale %q: sort %q: got %q, expected %q", tc.locale, tc.in, a, tc.out)
+		}
+	}
+	if err := mergeTestBase().Roots.Other.Sort(SortOptions{By: SortByName, Locale: "not a locale"}); err == nil {
+		t.Errorf("expected error for invalid locale")
+	}
+}
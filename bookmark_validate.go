@@ -0,0 +1,172 @@
+package crb
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type Severity int
+
+const (
+	SeverityWarning Severity = iota // Chrome will load it, but it's probably wrong
+	SeverityError                   // Chrome will reject or change it
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// Problem is an issue found by Validate.
+type Problem struct {
+	Severity Severity
+	Path     string // the node path, or empty if not specific to a node
+	ID       int    // the node ID, or 0 if not specific to a node
+	Message  string
+}
+
+func (p Problem) String() string {
+	if p.Path == "" && p.ID == 0 {
+		return fmt.Sprintf("%s: %s", p.Severity, p.Message)
+	}
+	return fmt.Sprintf("%s: %s (id %d): %s", p.Severity, p.Path, p.ID, p.Message)
+}
+
+// Validate checks b for structural problems, returning all of them in tree
+// order.
+func (b *Bookmarks) Validate() []Problem {
+	var ps []Problem
+	problem := func(sev Severity, path []string, n *BookmarkNode, format string, a ...interface{}) {
+		p := Problem{
+			Severity: sev,
+			Message:  fmt.Sprintf(format, a...),
+		}
+		if n != nil {
+			p.Path = strings.Join(path, "/")
+			p.ID = n.ID
+		}
+		ps = append(ps, p)
+	}
+
+	if err := b.Version.Valid(); err != nil {
+		problem(SeverityError, nil, nil, "%v", err)
+	}
+	if c := b.CalculateChecksum(); b.Checksum != c {
+		problem(SeverityError, nil, nil, "checksum is %q, expected %q", b.Checksum, c)
+	}
+	for _, f := range b.UnknownFields() {
+		problem(SeverityWarning, nil, nil, "unknown field %s", f)
+	}
+
+	ids := map[int]int{}
+	guids := map[[16]byte]int{}
+	b.walkPath(func(n *BookmarkNode, path []string) {
+		ids[n.ID]++
+		if g, err := n.GUID.Bytes(); err == nil {
+			guids[g]++
+		}
+	})
+
+	now := time.Now()
+	b.walkPath(func(n *BookmarkNode, path []string) {
+		if n.ID <= 0 {
+			problem(SeverityError, path, n, "id is not positive")
+		} else if ids[n.ID] > 1 {
+			problem(SeverityError, path, n, "id is used by %d nodes", ids[n.ID])
+		}
+
+		// invalid guids are rejected by Decode, but the tree may have been
+		// built in code
+		if n.GUID == "" {
+			problem(SeverityError, path, n, "guid is missing")
+		} else if g, err := n.GUID.Bytes(); err != nil {
+			problem(SeverityError, path, n, "guid %q is invalid: %v", string(n.GUID), err)
+		} else {
+			if guids[g] > 1 {
+				problem(SeverityError, path, n, "guid %s is used by %d nodes", n.GUID, guids[g])
+			}
+			if c, _ := n.GUID.Canonical(); string(n.GUID) != c {
+				problem(SeverityWarning, path, n, "guid %q is not in canonical form", string(n.GUID))
+			}
+		}
+
+		if err := n.Type.Valid(); err != nil {
+			problem(SeverityError, path, n, "%v", err)
+		}
+		switch n.Type {
+		case NodeTypeURL:
+			if n.Children != nil && len(*n.Children) != 0 {
+				problem(SeverityError, path, n, "url has %d children", len(*n.Children))
+			}
+			if n.URL == "" {
+				problem(SeverityError, path, n, "url is empty")
+			} else if u, err := url.Parse(n.URL); err != nil {
+				problem(SeverityError, path, n, "url is invalid: %v", err)
+			} else if !u.IsAbs() {
+				problem(SeverityWarning, path, n, "url %q is not absolute", n.URL)
+			}
+		case NodeTypeFolder:
+			if n.URL != "" {
+				problem(SeverityError, path, n, "folder has url %q", n.URL)
+			}
+		}
+
+		for _, t := range []struct {
+			Name string
+			Time Time
+		}{
+			{"date_added", n.DateAdded},
+			{"date_last_used", n.DateLastUsed},
+			{"date_modified", n.DateModified},
+		} {
+			if t.Time < 0 {
+				problem(SeverityError, path, n, "%s is before 1601", t.Name)
+			} else if t.Time.Time().After(now) {
+				problem(SeverityWarning, path, n, "%s is in the future (%s)", t.Name, t.Time)
+			}
+		}
+		if !n.DateModified.IsZero() && n.DateModified < n.DateAdded {
+			problem(SeverityWarning, path, n, "date_modified is before date_added")
+		}
+	})
+
+	b.guidProblems(func(n *BookmarkNode, msg string) {
+		var path []string
+		b.walkPath(func(x *BookmarkNode, p []string) {
+			if x == n {
+				path = append(path, p...)
+			}
+		})
+		problem(SeverityError, path, n, "%s", msg)
+	})
+	return ps
+}
+
+// walkPath calls fn for each node in b depth-first, with the path elements of
+// the node and its ancestors (including the permanent folder). The path must
+// not be retained.
+func (b *Bookmarks) walkPath(fn func(n *BookmarkNode, path []string)) {
+	var path []string
+	var walk func(n *BookmarkNode, e string)
+	walk = func(n *BookmarkNode, e string) {
+		path = append(path, e)
+		fn(n, path)
+		if n.Children != nil {
+			for i, e := range PathElements(*n.Children) {
+				walk(&(*n.Children)[i], e)
+			}
+		}
+		path = path[:len(path)-1]
+	}
+	for _, r := range b.roots() {
+		walk(r, EscapePathElement(r.Name))
+	}
+}
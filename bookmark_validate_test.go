@@ -0,0 +1,29 @@
+package crb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateGUID(t *testing.T) {
+	b := mergeTestBase()
+	mergeTestNode(b, "a1").GUID = "not-a-guid"
+	mergeTestNode(b, "a2").GUID = ""
+	mergeTestNode(b, "a3").GUID = "A8288040-0ACA-4275-8A89-22175F088BD7"
+	mergeTestNode(b, "b1").GUID = mergeTestGUID("B")
+
+	var act []string
+	for _, p := range b.Validate() {
+		act = append(act, p.String())
+	}
+	exp := []string{
+		`error: Bookmarks bar/A/a1 (id 3): guid "not-a-guid" is invalid: invalid guid format`,
+		`error: Bookmarks bar/A/a2 (id 4): guid is missing`,
+		`warning: Bookmarks bar/A/a3 (id 5): guid "A8288040-0ACA-4275-8A89-22175F088BD7" is not in canonical form`,
+		`error: Bookmarks bar/B (id 6): guid 00000000-0000-4000-8000-000000000042 is used by 2 nodes`,
+		`error: Bookmarks bar/B/b1 (id 7): guid 00000000-0000-4000-8000-000000000042 is used by 2 nodes`,
+	}
+	if a, e := strings.Join(act, "\n"), strings.Join(exp, "\n"); a != e {
+		t.Errorf("got:\n%s\n\nexpected:\n%s", a, e)
+	}
+}
@@ -0,0 +1,112 @@
+package crb
+
+import "errors"
+
+// RootType identifies a permanent folder by its key in the bookmarks file.
+type RootType string
+
+const (
+	RootBookmarkBar RootType = "bookmark_bar"
+	RootOther       RootType = "other"
+	RootMobile      RootType = "synced"
+)
+
+// rootTypes are the types of the nodes returned by roots.
+var rootTypes = [...]RootType{RootBookmarkBar, RootOther, RootMobile}
+
+// Root returns the permanent folder of the specified type, or nil.
+func (b *Bookmarks) Root(t RootType) *BookmarkNode {
+	for i, r := range b.roots() {
+		if rootTypes[i] == t {
+			return r
+		}
+	}
+	return nil
+}
+
+// ErrSkipFolder can be returned by Visitor.Enter to skip the children of the
+// current folder, which is still passed to Leave. If returned for a bookmark,
+// the remaining siblings of the bookmark are skipped. Like filepath.SkipDir, it
+// is not returned from Visit.
+var ErrSkipFolder = errors.New("skip this folder")
+
+// VisitState describes the location of a node being visited.
+type VisitState struct {
+	Root    RootType        // the permanent folder the node is in, or empty if not visiting from Bookmarks
+	Parents []*BookmarkNode // the ancestors of the node, starting at the root (must not be retained)
+	Index   int             // the index of the node in its parent, or -1 for the root
+	Depth   int             // the number of ancestors (i.e., len(Parents))
+}
+
+// Parent returns the parent of the node, or nil if it is the root.
+func (s VisitState) Parent() *BookmarkNode {
+	if len(s.Parents) == 0 {
+		return nil
+	}
+	return s.Parents[len(s.Parents)-1]
+}
+
+// Visitor is called for nodes when visiting a tree. If a function returns
+// ErrBreak or another error (other than ErrSkipFolder), visiting stops.
+type Visitor struct {
+	Enter func(n *BookmarkNode, s VisitState) error // before the children of a folder, or for a bookmark
+	Leave func(n *BookmarkNode, s VisitState) error // after the children of a folder (even if skipped), not called for bookmarks
+}
+
+// Visit visits the nodes in b depth-first, starting with each permanent folder.
+func (b *Bookmarks) Visit(v Visitor) error {
+	for i, r := range b.roots() {
+		if err := r.visit(v, VisitState{Root: rootTypes[i], Index: -1}); err != nil {
+			if err == ErrBreak || err == ErrSkipFolder {
+				err = nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Visit visits n and its descendants depth-first.
+func (n *BookmarkNode) Visit(v Visitor) error {
+	if err := n.visit(v, VisitState{Index: -1}); err != nil && err != ErrBreak && err != ErrSkipFolder {
+		return err
+	}
+	return nil
+}
+
+func (n *BookmarkNode) visit(v Visitor, s VisitState) error {
+	var skip bool
+	if v.Enter != nil {
+		if err := v.Enter(n, s); err != nil {
+			if err != ErrSkipFolder || n.Type != NodeTypeFolder {
+				return err
+			}
+			skip = true
+		}
+	}
+	if n.Type != NodeTypeFolder {
+		return nil
+	}
+	if n.Children != nil && !skip {
+		cs := VisitState{
+			Root:    s.Root,
+			Parents: append(s.Parents, n),
+			Depth:   s.Depth + 1,
+		}
+		for i := range *n.Children {
+			cs.Index = i
+			if err := (&(*n.Children)[i]).visit(v, cs); err != nil {
+				if err == ErrSkipFolder {
+					break // skip the remaining siblings
+				}
+				return err
+			}
+		}
+	}
+	if v.Leave != nil {
+		if err := v.Leave(n, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package crb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVisitSkipFolder(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "Bookmarks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	b, _, _, err := DecodeLenient(f)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	var events []string
+	if err := b.Visit(Visitor{
+		Enter: func(n *BookmarkNode, s VisitState) error {
+			events = append(events, "+"+n.Name)
+			if n.Name == "Work\tStuff" {
+				return ErrSkipFolder
+			}
+			return nil
+		},
+		Leave: func(n *BookmarkNode, s VisitState) error {
+			events = append(events, "-"+n.Name)
+			return nil
+		},
+	}); err != nil {
+		t.Fatalf("visit: %v", err)
+	}
+
+	exp := []string{
+		"+Bookmarks bar",
+		"+Example <b>Bold</b> & \"Quoted\"",
+		"+Work\tStuff",
+		"-Work\tStuff",
+		"-Bookmarks bar",
+		"+Other bookmarks",
+		"-Other bookmarks",
+		"+Mobile bookmarks",
+		"-Mobile bookmarks",
+	}
+	if act := strings.Join(events, "\n"); act != strings.Join(exp, "\n") {
+		t.Errorf("unexpected events:\n%s", act)
+	}
+}
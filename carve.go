@@ -1,93 +1,267 @@
 package crb
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/json"
 	"io"
+	"runtime"
+	"slices"
+	"sync"
 )
 
 type CarveMatchFunc func(off int64, buf []byte, obj *Bookmarks) error
 
+const (
+	carveMaxSize   = 20 * 1024 * 1024 // default maximum size of a bookmarks file
+	carveChunkSize = 4 * 1024 * 1024  // default chunk size
+)
+
+// CarveOptions controls how bookmarks are carved.
+//
+// Each worker reads its chunk plus a small margin, and may read up to MaxSize
+// bytes at a time to decode or salvage a match, so carving uses about
+// Workers*(ChunkSize+MaxSize) bytes of memory in addition to the matches which
+// haven't been reported yet.
+type CarveOptions struct {
+	Workers   int   // number of chunks to scan concurrently (0 for GOMAXPROCS)
+	ChunkSize int64 // number of bytes to scan at a time (0 for 4 MiB)
+	MaxSize   int64 // maximum size of a bookmarks file (0 for 20 MiB)
+
+	// Signatures identify the start of bookmarks files. If empty,
+	// CarveSignatures is used.
+	Signatures []CarveSignature
+
+	// Salvage, if set, is called in offset order with the bookmarks which
+	// were truncated, had an invalid checksum, or couldn't be decoded.
+	Salvage CarveSalvageFunc
+}
+
 // Carve attempts to recover valid Chrome bookmarks from r, which could be a
 // disk image or something similar. It stops if ErrBreak or another error is
-// returned.
+// returned. It is equivalent to CarveOptions{}.Carve(f, -1, fn).
 func Carve(f io.ReaderAt, fn CarveMatchFunc) error {
-	const (
-		BufferSize = 8192
-		MaxSize    = 20 * 1024 * 1024
-	)
+	return CarveOptions{}.Carve(f, -1, fn)
+}
+
+// Carve attempts to recover valid Chrome bookmarks from the first size bytes of
+// f, or until EOF if size is negative. The file is split into chunks which are
+// scanned concurrently, but fn is called sequentially in offset order. It
+// stops if ErrBreak or another error is returned.
+func (o CarveOptions) Carve(f io.ReaderAt, size int64, fn CarveMatchFunc) error {
+	if size < 0 {
+		size = 1<<63 - 1
+	}
+	err := o.defaults().carve(f, 0, size, size, fn)
+	if err == ErrBreak {
+		err = nil
+	}
+	return err
+}
+
+// defaults returns o with the default values filled in.
+func (o CarveOptions) defaults() CarveOptions {
+	if o.Workers <= 0 {
+		o.Workers = runtime.GOMAXPROCS(0)
+	}
+	if o.ChunkSize <= 0 {
+		o.ChunkSize = carveChunkSize
+	}
+	if o.MaxSize <= 0 {
+		o.MaxSize = carveMaxSize
+	}
+	if len(o.Signatures) == 0 {
+		o.Signatures = CarveSignatures
+	}
+	return o
+}
+
+// margin returns the number of bytes after a chunk which may be read to find
+// files starting in it.
+func (o CarveOptions) margin() int64 {
+	var prefix int
+	for _, s := range o.Signatures {
+		prefix = max(prefix, len(s.Prefix))
+	}
+	return carveLookback + 1 + int64(prefix)
+}
 
+// carve finds bookmarks starting between from and to in the first size bytes
+// of f. It returns ErrBreak as-is.
+func (o CarveOptions) carve(f io.ReaderAt, from, to, size int64, fn CarveMatchFunc) error {
+	type job struct {
+		off int64
+		res chan carveChunk
+	}
 	var (
-		s1 = []byte("{\n   \"checksum\": \"")
-		s2 = []byte("   \"roots\": {\n      \"bookmark_bar\": {")
+		wg      sync.WaitGroup
+		done    = make(chan struct{})
+		jobs    = make(chan job)
+		pending = make(chan chan carveChunk, o.Workers*2) // in offset order, bounding the number of chunks in memory
 	)
 
-	// note: we can do it this way without backtracking or additional
-	// buffering since the s1[0] isn't in s1[1:]
-
-	r := bufio.NewReaderSize(io.NewSectionReader(f, 0, 1<<63-1), BufferSize)
-	jb := make(json.RawMessage, MaxSize)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(jobs)
+		defer close(pending)
+		for off := from; off < to; off += o.ChunkSize {
+			j := job{off, make(chan carveChunk, 1)}
+			select {
+			case pending <- j.res:
+			case <-done:
+				return
+			}
+			select {
+			case jobs <- j:
+			case <-done:
+				return
+			}
+		}
+	}()
 
-	var off int64
-	for {
-		var nm bool
-		for _, x := range s1 {
-			c, err := r.ReadByte()
-			if err != nil {
-				if err == io.EOF {
-					err = nil
+	for i := 0; i < o.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				select {
+				case <-done:
+					j.res <- carveChunk{}
+				default:
+					j.res <- o.carveScan(f, j.off, min(o.ChunkSize, to-j.off), size)
 				}
-				return err
 			}
-			off++
+		}()
+	}
 
-			if c != x {
-				if c == s1[0] {
-					off--
-					r.UnreadByte()
-				}
-				nm = true
-				break
+	defer wg.Wait()
+	defer close(done)
+
+	for c := range pending {
+		r := <-c
+		for _, m := range r.ms {
+			var err error
+			if m.salv != nil {
+				err = o.Salvage(m.off, m.buf, m.salv)
+			} else if fn != nil {
+				err = fn(m.off, m.buf, m.obj)
+			}
+			if err != nil {
+				return err
 			}
 		}
-		if nm {
-			continue
+		if r.err != nil || r.eof {
+			return r.err
 		}
+	}
+	return nil
+}
+
+type carveMatch struct {
+	off  int64
+	buf  []byte
+	obj  *Bookmarks
+	salv *Salvaged
+}
+
+type carveChunk struct {
+	ms  []carveMatch
+	eof bool // no more chunks
+	err error
+}
 
-		sr := io.NewSectionReader(f, off, MaxSize)
+// carveScan finds bookmarks starting in the n bytes at off.
+func (o CarveOptions) carveScan(f io.ReaderAt, off, n, size int64) carveChunk {
+	var r carveChunk
 
-		sb := make([]byte, 1024)
-		if n, err := sr.Read(sb); err != nil {
-			return err
-		} else {
-			sb = sb[:n]
+	// include enough of the surrounding chunks to match a signature for a
+	// file starting in this one
+	lo := max(off-carveLookback-1, 0)
+	hi := min(off+n+o.margin(), size)
+	buf := make([]byte, hi-lo)
+	if x, err := f.ReadAt(buf, lo); err != nil {
+		if err != io.EOF {
+			r.err = err
+			return r
 		}
-		if !bytes.Contains(sb, s2) {
-			continue
+		if lo+int64(x) <= off+n {
+			r.eof = true
 		}
+		buf = buf[:x]
+	}
 
-		// attempt to read the json bytes and ensure it's actually json at the same time
-		if err := json.NewDecoder(io.MultiReader(
-			bytes.NewReader(s1),
-			bytes.NewReader(sb),
-			sr,
-		)).Decode(&jb); err != nil {
-			continue
+	var starts []int64
+	seen := map[int64]bool{}
+	for _, s := range o.Signatures {
+		for i := 0; i < len(buf); i++ {
+			j := bytes.Index(buf[i:], s.Prefix)
+			if j == -1 {
+				break
+			}
+			i += j
+			if st, ok := s.start(buf, i); ok {
+				if x := lo + int64(st); x >= off && x < off+n && !seen[x] {
+					starts = append(starts, x)
+					seen[x] = true
+				}
+			}
 		}
+	}
+	slices.Sort(starts)
 
-		obj, valid, err := Decode(bytes.NewReader(jb))
-		if err != nil || !valid {
-			continue
+	for _, x := range starts {
+		if m, ok, err := o.carveAt(f, x, size); err != nil {
+			r.err = err
+			return r
+		} else if ok {
+			r.ms = append(r.ms, m)
 		}
+	}
+	return r
+}
 
-		if fn != nil {
-			if err := fn(off-int64(len(s1)), []byte(jb), obj); err != nil {
-				if err == ErrBreak {
-					err = nil
-				}
-				return err
-			}
+// carveAt attempts to read bookmarks starting at off. If o.Salvage is set,
+// bookmarks which aren't valid are salvaged.
+func (o CarveOptions) carveAt(f io.ReaderAt, off, size int64) (carveMatch, bool, error) {
+	sr := io.NewSectionReader(f, off, min(o.MaxSize, size-off))
+
+	hb := make([]byte, carveHeaderSize)
+	if n, err := sr.ReadAt(hb, 0); err != nil && err != io.EOF {
+		return carveMatch{}, false, err
+	} else {
+		hb = hb[:n]
+	}
+	if !slices.ContainsFunc(o.Signatures, func(s CarveSignature) bool {
+		return s.Header.Match(hb)
+	}) {
+		return carveMatch{}, false, nil
+	}
+
+	// attempt to read the json bytes and ensure it's actually json at the same time
+	var jb json.RawMessage
+	var derr error
+	if err := json.NewDecoder(sr).Decode(&jb); err == nil {
+		obj, valid, err := Decode(bytes.NewReader(jb))
+		if err == nil && valid {
+			return carveMatch{off, []byte(jb), obj, nil}, true, nil
 		}
+		derr = err
+	}
+	if o.Salvage == nil {
+		return carveMatch{}, false, nil
+	}
+
+	// it's probably truncated, so read as much as possible and try again
+	buf, err := io.ReadAll(io.NewSectionReader(f, off, min(o.MaxSize, size-off)))
+	if err != nil {
+		return carveMatch{}, false, err
+	}
+	s, n := salvage(buf)
+	if s == nil {
+		return carveMatch{}, false, nil
+	}
+	if s.DecodeErr = derr; s.Recovered == 0 && !s.ChecksumMismatch && s.DecodeErr == nil {
+		return carveMatch{}, false, nil
 	}
+	return carveMatch{off, buf[:n], nil, s}, true, nil
 }
@@ -0,0 +1,260 @@
+package crb
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"slices"
+)
+
+// CarveSalvageFunc is called with bookmarks which could only be partially
+// recovered. The buf contains the bytes which were parsed.
+type CarveSalvageFunc func(off int64, buf []byte, s *Salvaged) error
+
+// Salvaged is a partially recovered bookmarks file.
+type Salvaged struct {
+	Bookmarks        *Bookmarks // the intact nodes, with missing permanent folders added and the checksum updated
+	Checksum         string     // the original checksum, if it was intact
+	Truncated        bool       // the json ended early or was corrupted
+	ChecksumMismatch bool       // the json was complete, but the checksum didn't match
+	DecodeErr        error      // the json was complete, but Decode failed (e.g., a field had the wrong type)
+	Recovered        int        // number of non-permanent folders and bookmarks recovered
+}
+
+// salvageObject is a partially parsed object.
+type salvageObject struct {
+	m        map[string]any
+	complete bool
+}
+
+// salvageArray is a partially parsed array.
+type salvageArray struct {
+	a        []any
+	complete bool
+}
+
+// salvage recovers the intact nodes from the possibly truncated or invalid
+// bookmarks json in buf. It returns the number of bytes parsed.
+func salvage(buf []byte) (*Salvaged, int64) {
+	d := json.NewDecoder(bytes.NewReader(buf))
+	d.UseNumber()
+
+	v, err := salvageParse(d)
+	top, ok := v.(*salvageObject)
+	if !ok {
+		return nil, 0
+	}
+	roots, ok := top.m["roots"].(*salvageObject)
+	if !ok {
+		return nil, 0
+	}
+
+	s := &Salvaged{
+		Bookmarks: new(Bookmarks),
+		Truncated: err != nil || !top.complete,
+	}
+	s.Checksum, _ = top.m["checksum"].(string)
+
+	b := s.Bookmarks
+	b.Version = CurrentVersion
+	for _, r := range []struct {
+		Key  string
+		Name string
+		GUID GUID
+		Node *BookmarkNode
+	}{
+		{"bookmark_bar", "Bookmarks bar", BookmarkBarGUID, &b.Roots.BookmarkBar},
+		{"other", "Other bookmarks", OtherBookmarksGUID, &b.Roots.Other},
+		{"synced", "Mobile bookmarks", MobileBookmarksGUID, &b.Roots.MobileBookmark},
+	} {
+		if n, ok := salvageNode(roots.m[r.Key]); ok && n.Type == NodeTypeFolder {
+			if n.Name == "" {
+				n.Name = r.Name
+			}
+			if n.GUID == "" {
+				n.GUID = r.GUID
+			}
+			*r.Node = n
+		} else {
+			*r.Node = importRoot(r.Name, r.GUID, 0) // no date so it doesn't affect the most recent one
+		}
+	}
+	salvageFields(top, b, &b.Extra, "checksum", "roots", "version")
+	salvageFields(roots, &b.Roots, &b.Roots.Extra, "bookmark_bar", "other", "synced")
+
+	// check the original ids before fixing them
+	if !s.Truncated {
+		s.ChecksumMismatch = s.Checksum != b.CalculateChecksum()
+	}
+	for _, r := range b.roots() {
+		for range r.Descendants() {
+			s.Recovered++
+		}
+	}
+	if x, _ := b.find(func(n *BookmarkNode) bool { return n.ID <= 0 }); x != nil || len(b.DuplicateIDs()) != 0 {
+		b.ReassignIDs()
+	}
+	b.find(func(n *BookmarkNode) bool {
+		if n.GUID == "" {
+			n.GUID = NewGUID()
+		}
+		return false
+	})
+	b.UpdateChecksum()
+	return s, d.InputOffset()
+}
+
+// salvageParse parses the next value from d, returning the partial value if
+// an error occurs within an object or array.
+func salvageParse(d *json.Decoder) (any, error) {
+	t, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t {
+	case json.Delim('{'):
+		o := &salvageObject{m: map[string]any{}}
+		for d.More() {
+			k, err := d.Token()
+			if err != nil {
+				return o, err
+			}
+			v, err := salvageParse(d)
+			if v != nil || err == nil {
+				o.m[k.(string)] = v // including nulls, since unknown fields keep them
+			}
+			if err != nil {
+				return o, err
+			}
+		}
+		if _, err := d.Token(); err != nil {
+			return o, err
+		}
+		o.complete = true
+		return o, nil
+	case json.Delim('['):
+		a := &salvageArray{}
+		for d.More() {
+			v, err := salvageParse(d)
+			if v != nil {
+				a.a = append(a.a, v)
+			}
+			if err != nil {
+				return a, err
+			}
+		}
+		if _, err := d.Token(); err != nil {
+			return a, err
+		}
+		a.complete = true
+		return a, nil
+	default:
+		return t, nil
+	}
+}
+
+// salvagePlain converts v into a value which can be marshaled, returning false
+// if any part of it is incomplete.
+func salvagePlain(v any) (any, bool) {
+	switch v := v.(type) {
+	case *salvageObject:
+		if !v.complete {
+			return nil, false
+		}
+		m := make(map[string]any, len(v.m))
+		for k, x := range v.m {
+			p, ok := salvagePlain(x)
+			if !ok {
+				return nil, false
+			}
+			m[k] = p
+		}
+		return m, true
+	case *salvageArray:
+		if !v.complete {
+			return nil, false
+		}
+		a := make([]any, 0, len(v.a))
+		for _, x := range v.a {
+			p, ok := salvagePlain(x)
+			if !ok {
+				return nil, false
+			}
+			a = append(a, p)
+		}
+		return a, true
+	default:
+		return v, true
+	}
+}
+
+// salvageFields decodes the intact fields of o other than skip into v one at a
+// time so invalid ones are skipped. Since each decode replaces the unknown
+// fields, they are collected into extra separately.
+func salvageFields(o *salvageObject, v any, extra *map[string]json.RawMessage, skip ...string) {
+	var m map[string]json.RawMessage
+	for k, x := range o.m {
+		if slices.Contains(skip, k) {
+			continue
+		}
+		if p, ok := salvagePlain(x); ok {
+			if buf, err := json.Marshal(map[string]any{k: p}); err == nil {
+				if json.Unmarshal(buf, v) == nil && len(*extra) != 0 {
+					if m == nil {
+						m = map[string]json.RawMessage{}
+					}
+					maps.Copy(m, *extra)
+				}
+			}
+		}
+	}
+	*extra = m
+}
+
+// salvageNode recovers a node from v, which may be incomplete. Incomplete
+// folders keep the intact fields and children. Incomplete bookmarks are only
+// kept if the url is intact.
+func salvageNode(v any) (BookmarkNode, bool) {
+	var n BookmarkNode
+	o, ok := v.(*salvageObject)
+	if !ok {
+		return n, false
+	}
+	if p, ok := salvagePlain(o); ok {
+		if buf, err := json.Marshal(p); err == nil {
+			if err := json.Unmarshal(buf, &n); err == nil && n.Type.Valid() == nil {
+				return n, true
+			}
+		}
+		n = BookmarkNode{}
+	}
+
+	salvageFields(o, &n, &n.Extra, "children")
+	if a, ok := o.m["children"].(*salvageArray); ok {
+		cs := make([]BookmarkNode, 0, len(a.a))
+		for _, x := range a.a {
+			if c, ok := salvageNode(x); ok {
+				cs = append(cs, c)
+			}
+		}
+		n.Children = &cs
+		if n.Type == "" {
+			n.Type = NodeTypeFolder
+		}
+	}
+
+	switch n.Type {
+	case NodeTypeFolder:
+		if n.Children == nil {
+			n.Children = new([]BookmarkNode)
+		}
+	case NodeTypeURL:
+		if n.URL == "" {
+			return n, false
+		}
+		n.Children = nil
+	default:
+		return n, false
+	}
+	return n, true
+}
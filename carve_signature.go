@@ -0,0 +1,67 @@
+package crb
+
+import (
+	"regexp"
+)
+
+// carveLookback is the maximum amount of whitespace between the opening brace
+// of a bookmarks file and a CarveSignature prefix which doesn't include it.
+const carveLookback = 64
+
+// carveHeaderSize is the number of bytes matched against the header of a
+// CarveSignature.
+const carveHeaderSize = 1024
+
+// CarveSignature identifies the start of a bookmarks file.
+type CarveSignature struct {
+	Name string
+
+	// Prefix is searched for to find possible bookmarks files. If it doesn't
+	// start with an opening brace, the file starts at the preceding one, which
+	// may only be separated from the prefix by whitespace.
+	Prefix []byte
+
+	// Header must match at the start of the first 1024 bytes of the file.
+	Header *regexp.Regexp
+}
+
+// CarveSignatures are the built-in signatures, which are all used by default.
+var CarveSignatures = []CarveSignature{
+	{
+		Name:   "chrome",
+		Prefix: []byte("{\n   \"checksum\": \""),
+		Header: regexp.MustCompile(`^\{\n   "checksum": "[^"]*",\n   "roots": \{\n      "bookmark_bar": \{`),
+	},
+	{
+		Name:   "chrome-crlf",
+		Prefix: []byte("{\r\n   \"checksum\": \""),
+		Header: regexp.MustCompile(`^\{\r\n   "checksum": "[^"]*",\r\n   "roots": \{\r\n      "bookmark_bar": \{`),
+	},
+	{
+		Name:   "compact",
+		Prefix: []byte("{\"checksum\":\""),
+		Header: regexp.MustCompile(`^\{"checksum":"[^"]*","roots":\{"bookmark_bar":\{`),
+	},
+	{
+		Name:   "json",
+		Prefix: []byte("\"checksum\""),
+		Header: regexp.MustCompile(`^\{\s*"checksum"\s*:\s*"[^"]*"\s*,\s*"roots"\s*:\s*\{\s*"bookmark_bar"\s*:\s*\{`),
+	},
+}
+
+// start returns the start of the file for the prefix at i in buf.
+func (s CarveSignature) start(buf []byte, i int) (int, bool) {
+	if len(s.Prefix) != 0 && s.Prefix[0] == '{' {
+		return i, true
+	}
+	for j := i - 1; j >= 0 && j >= i-carveLookback-1; j-- {
+		switch buf[j] {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '{':
+			return j, true
+		}
+		break
+	}
+	return 0, false
+}
@@ -0,0 +1,77 @@
+package crb
+
+import (
+	"errors"
+	"io"
+	"slices"
+)
+
+// CarveReader is like Carve, but it reads r sequentially, so it can be used
+// with pipes. Matches are still reported in offset order. It keeps a sliding
+// window of up to about twice MaxSize in memory, which is only grown as needed,
+// in addition to the memory used by the workers (see CarveOptions).
+func (o CarveOptions) CarveReader(r io.Reader, fn CarveMatchFunc) error {
+	o = o.defaults()
+
+	// scan everything which can't be the start of a file extending past the
+	// end of the window, then discard everything but the lookback before it
+	margin := o.margin()
+	limit := 2 * (o.MaxSize + margin)
+	w := new(carveWindow)
+	var from int64
+	for {
+		if len(w.buf) == cap(w.buf) {
+			w.buf = slices.Grow(w.buf, int(min(max(int64(cap(w.buf)), 64*1024), limit-int64(len(w.buf)))))
+		}
+		n, err := io.ReadFull(r, w.buf[len(w.buf):cap(w.buf)])
+		w.buf = w.buf[:len(w.buf)+n]
+
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			return err
+		}
+
+		end := w.base + int64(len(w.buf))
+		to, size := end-o.MaxSize-margin, int64(1<<63-1)
+		if eof {
+			to, size = end, end
+		}
+		if to > from {
+			if err := o.carve(w, from, to, size, fn); err != nil {
+				if err == ErrBreak {
+					err = nil
+				}
+				return err
+			}
+			from = to
+		}
+		if eof {
+			return nil
+		}
+
+		if x := from - carveLookback - 1 - w.base; x > 0 {
+			w.buf = w.buf[:copy(w.buf, w.buf[x:])]
+			w.base += x
+		}
+	}
+}
+
+// carveWindow is an io.ReaderAt for the bytes of a stream starting at base.
+type carveWindow struct {
+	base int64
+	buf  []byte
+}
+
+func (w *carveWindow) ReadAt(p []byte, off int64) (int, error) {
+	if off < w.base {
+		return 0, errors.New("read before carve window") // shouldn't happen
+	}
+	if off-w.base >= int64(len(w.buf)) {
+		return 0, io.EOF
+	}
+	n := copy(p, w.buf[off-w.base:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
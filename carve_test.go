@@ -0,0 +1,355 @@
+package crb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"runtime"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestCarveChunkBoundary(t *testing.T) {
+	const chunk = 4096
+	file := carveTestFile("boundary")
+	for _, sig := range []string{"", "chrome", "json"} {
+		var o CarveOptions
+		for _, s := range CarveSignatures {
+			if sig == "" || s.Name == sig {
+				o.Signatures = append(o.Signatures, s)
+			}
+		}
+		o.ChunkSize = chunk
+		o.Workers = 4
+
+		// every position where the file, its prefix, or the lookback could
+		// cross the boundary
+		for off := int64(chunk - carveLookback - 32); off <= chunk+4; off++ {
+			img := carveTestImage(chunk*4, map[int64][]byte{off: file})
+			var ms []int64
+			if err := o.Carve(bytes.NewReader(img), int64(len(img)), func(x int64, buf []byte, obj *Bookmarks) error {
+				ms = append(ms, x)
+				return nil
+			}); err != nil {
+				t.Fatalf("signatures %q, offset %d: %v", sig, off, err)
+			}
+			if len(ms) != 1 || ms[0] != off {
+				t.Errorf("signatures %q, offset %d: got matches at %v", sig, off, ms)
+			}
+		}
+	}
+}
+
+func TestCarveOrder(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	files := map[int64][]byte{}
+	var exp []int64
+	for off := int64(0); len(exp) < 100; {
+		off += 1 + r.Int64N(8192)
+		f := carveTestFile(fmt.Sprint(len(exp)))
+		files[off] = f
+		exp = append(exp, off)
+		off += int64(len(f))
+	}
+	img := carveTestImage(exp[len(exp)-1]+16384, files)
+
+	for _, chunk := range []int64{512, 1000, 4096, 1 << 20} {
+		for _, workers := range []int{1, 3, 16} {
+			var act []int64
+			if err := (CarveOptions{Workers: workers, ChunkSize: chunk}).Carve(bytes.NewReader(img), -1, func(off int64, buf []byte, obj *Bookmarks) error {
+				if !bytes.Equal(buf, bytes.TrimSuffix(files[off], []byte("\n"))) {
+					t.Errorf("chunk %d, workers %d: incorrect match at %d", chunk, workers, off)
+				}
+				if n := fmt.Sprint(len(act)); obj.Roots.BookmarkBar.Name != n {
+					t.Errorf("chunk %d, workers %d: expected file %s at %d, got %s", chunk, workers, n, off, obj.Roots.BookmarkBar.Name)
+				}
+				act = append(act, off)
+				return nil
+			}); err != nil {
+				t.Fatalf("chunk %d, workers %d: %v", chunk, workers, err)
+			}
+			if !slices.Equal(act, exp) {
+				t.Errorf("chunk %d, workers %d: got matches at %v, expected %v", chunk, workers, act, exp)
+			}
+		}
+	}
+}
+
+func TestCarveReader(t *testing.T) {
+	r := rand.New(rand.NewPCG(5, 6))
+	files := map[int64][]byte{}
+	var exp []int64
+	for off := int64(0); len(exp) < 50; {
+		off += 1 + r.Int64N(4096)
+		f := carveTestFile(fmt.Sprint(len(exp)))
+		files[off] = f
+		exp = append(exp, off)
+		off += int64(len(f))
+	}
+	img := carveTestImage(exp[len(exp)-1]+int64(len(files[exp[len(exp)-1]]))+r.Int64N(16), files)
+
+	for _, maxSize := range []int64{0, 1024, 4096, 10000} {
+		for _, chunk := range []int64{0, 1000} {
+			o := CarveOptions{Workers: 3, ChunkSize: chunk, MaxSize: maxSize}
+			var act []int64
+			if err := o.CarveReader(iotest.HalfReader(bytes.NewReader(img)), func(off int64, buf []byte, obj *Bookmarks) error {
+				if !bytes.Equal(buf, bytes.TrimSuffix(files[off], []byte("\n"))) {
+					t.Errorf("max size %d, chunk %d: incorrect match at %d", maxSize, chunk, off)
+				}
+				act = append(act, off)
+				return nil
+			}); err != nil {
+				t.Fatalf("max size %d, chunk %d: %v", maxSize, chunk, err)
+			}
+			var ref []int64
+			if err := o.Carve(bytes.NewReader(img), -1, func(off int64, buf []byte, obj *Bookmarks) error {
+				ref = append(ref, off)
+				return nil
+			}); err != nil {
+				t.Fatalf("max size %d, chunk %d: %v", maxSize, chunk, err)
+			}
+			if !slices.Equal(act, ref) {
+				t.Errorf("max size %d, chunk %d: got matches at %v, expected %v", maxSize, chunk, act, ref)
+			}
+			if maxSize == 1024 && len(act) != 0 {
+				t.Errorf("max size %d: files larger than the max size were matched", maxSize)
+			}
+			if maxSize != 1024 && !slices.Equal(act, exp) {
+				t.Errorf("max size %d, chunk %d: got matches at %v, expected %v", maxSize, chunk, act, exp)
+			}
+		}
+	}
+}
+
+func TestCarveReaderSmall(t *testing.T) {
+	img := carveTestImage(8192, map[int64][]byte{100: carveTestFile("small")})
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	alloc := ms.TotalAlloc
+
+	var n int
+	if err := (CarveOptions{}).CarveReader(bytes.NewReader(img), func(off int64, buf []byte, obj *Bookmarks) error {
+		n++
+		return nil
+	}); err != nil {
+		t.Fatalf("carve: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 match, got %d", n)
+	}
+
+	// the window shouldn't be allocated upfront
+	runtime.ReadMemStats(&ms)
+	if x := ms.TotalAlloc - alloc; x > 1<<20 {
+		t.Errorf("allocated %d bytes to carve %d bytes", x, len(img))
+	}
+}
+
+func TestCarveBreak(t *testing.T) {
+	const (
+		chunk   = 4096
+		workers = 4
+		nchunks = 4096
+	)
+	files := map[int64][]byte{}
+	for i := int64(0); i < nchunks; i += 8 {
+		files[i*chunk+100] = carveTestFile("break")
+	}
+	img := carveTestImage(chunk*nchunks, files)
+	ra := &carveTestReader{r: bytes.NewReader(img)}
+
+	goroutines := runtime.NumGoroutine()
+
+	var n int
+	if err := (CarveOptions{Workers: workers, ChunkSize: chunk}).Carve(ra, -1, func(off int64, buf []byte, obj *Bookmarks) error {
+		if n++; n == 3 {
+			return ErrBreak
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("carve: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3 matches before stopping, got %d", n)
+	}
+
+	// each worker may have been scanning a chunk, and the dispatcher may have
+	// queued some, but nothing should be read after Carve returns
+	reads := ra.n.Load()
+	time.Sleep(50 * time.Millisecond)
+	if x := ra.n.Load(); x != reads {
+		t.Errorf("%d reads after carve returned", x-reads)
+	}
+	if max := int64(3*8 + workers*3); ra.chunks() > max {
+		t.Errorf("read %d chunks, expected at most %d", ra.chunks(), max)
+	}
+	for i := 0; runtime.NumGoroutine() > goroutines; i++ {
+		if i == 100 {
+			t.Fatalf("goroutines leaked (%d before, %d after)", goroutines, runtime.NumGoroutine())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCarveSalvageDecodeErr(t *testing.T) {
+	// valid checksum, but duplicate ids (which must be checked before they're
+	// reassigned) and an unknown field (so it can't be strictly decoded)
+	var b Bookmarks
+	if err := json.Unmarshal(carveTestFile("salvage"), &b); err != nil {
+		t.Fatal(err)
+	}
+	for i := range *b.Roots.BookmarkBar.Children {
+		(*b.Roots.BookmarkBar.Children)[i].ID = 100
+	}
+	b.Extra = map[string]json.RawMessage{"unknown": json.RawMessage(`true`)}
+	var buf bytes.Buffer
+	if err := (EncodeOptions{UpdateChecksum: true}).Encode(&buf, &b); err != nil {
+		t.Fatal(err)
+	}
+	img := carveTestImage(16384, map[int64][]byte{1000: buf.Bytes()})
+
+	var ss []*Salvaged
+	if err := (CarveOptions{Salvage: func(off int64, buf []byte, s *Salvaged) error {
+		ss = append(ss, s)
+		return nil
+	}}).Carve(bytes.NewReader(img), -1, func(off int64, buf []byte, obj *Bookmarks) error {
+		t.Errorf("unexpected match at %d", off)
+		return nil
+	}); err != nil {
+		t.Fatalf("carve: %v", err)
+	}
+	if len(ss) != 1 {
+		t.Fatalf("expected 1 salvaged file, got %d", len(ss))
+	}
+	if s := ss[0]; s.Truncated || s.ChecksumMismatch || s.DecodeErr == nil || s.Recovered != 8 || s.Checksum != b.CalculateChecksum() {
+		t.Errorf("unexpected result %+v", *s)
+	}
+	if len(ss[0].Bookmarks.DuplicateIDs()) != 0 {
+		t.Errorf("duplicate ids not reassigned")
+	}
+}
+
+func TestCarveSalvageExtra(t *testing.T) {
+	// truncated, with a bookmark which can't be decoded as a whole (so it and
+	// its parent are decoded field by field)
+	s, _ := salvage([]byte(`{"checksum":"x","roots":{"bookmark_bar":{"children":[{"guid":"00000000-0000-4000-8000-000000000001","id":"x","name":"a","type":"url","url":"https://example.com/","x_node":1,"y_node":[2]}],"name":"Bookmarks bar","type":"folder","x_folder":true,"y_folder":null},"x_roots":"r"},"version":1,"x_top":{"a":1},"meta_info":{"k":"v"},"y_top":[`))
+	if s == nil {
+		t.Fatal("nothing salvaged")
+	}
+	b := s.Bookmarks
+	if !s.Truncated || s.Recovered != 1 || b.MetaInfo["k"] != "v" {
+		t.Errorf("unexpected result %+v", *s)
+	}
+	for _, x := range []struct {
+		name  string
+		extra map[string]json.RawMessage
+		exp   string
+	}{
+		{"top", b.Extra, `{"x_top":{"a":1}}`},
+		{"roots", b.Roots.Extra, `{"x_roots":"r"}`},
+		{"folder", b.Roots.BookmarkBar.Extra, `{"x_folder":true,"y_folder":null}`},
+		{"bookmark", (*b.Roots.BookmarkBar.Children)[0].Extra, `{"x_node":1,"y_node":[2]}`},
+	} {
+		if buf, err := json.Marshal(x.extra); err != nil {
+			t.Errorf("%s: %v", x.name, err)
+		} else if string(buf) != x.exp {
+			t.Errorf("%s: got unknown fields %s, expected %s", x.name, buf, x.exp)
+		}
+	}
+}
+
+func BenchmarkCarve(b *testing.B) {
+	files := map[int64][]byte{}
+	for i := int64(0); i < 64; i++ {
+		files[i<<20+12345] = carveTestFile(fmt.Sprint(i))
+	}
+	img := carveTestImage(64<<20, files)
+
+	for _, bc := range []struct {
+		name    string
+		workers int
+	}{
+		{"Workers=1", 1},
+		{"Workers=GOMAXPROCS", runtime.GOMAXPROCS(0)},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.SetBytes(int64(len(img)))
+			for i := 0; i < b.N; i++ {
+				var n int
+				if err := (CarveOptions{Workers: bc.workers}).Carve(bytes.NewReader(img), -1, func(off int64, buf []byte, obj *Bookmarks) error {
+					n++
+					return nil
+				}); err != nil {
+					b.Fatal(err)
+				}
+				if n != len(files) {
+					b.Fatalf("expected %d matches, got %d", len(files), n)
+				}
+			}
+		})
+	}
+}
+
+// carveTestFile returns a valid bookmarks file with the bookmarks bar named
+// name.
+func carveTestFile(name string) []byte {
+	b := &Bookmarks{Version: CurrentVersion}
+	b.Roots.BookmarkBar = importRoot(name, BookmarkBarGUID, 13344473600000000)
+	b.Roots.Other = importRoot("Other bookmarks", OtherBookmarksGUID, 13344473600000000)
+	b.Roots.MobileBookmark = importRoot("Mobile bookmarks", MobileBookmarksGUID, 13344473600000000)
+	for i := 0; i < 8; i++ {
+		*b.Roots.BookmarkBar.Children = append(*b.Roots.BookmarkBar.Children, BookmarkNode{
+			DateAdded: 13344473601000000,
+			GUID:      GUID(fmt.Sprintf("00000000-0000-4000-8000-%012d", i)),
+			Name:      fmt.Sprintf("Bookmark %d", i),
+			Type:      NodeTypeURL,
+			URL:       fmt.Sprintf("https://example.com/%d", i),
+		})
+	}
+	b.ReassignIDs()
+
+	var buf bytes.Buffer
+	if err := (EncodeOptions{UpdateChecksum: true}).Encode(&buf, b); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+// carveTestImage returns size bytes of pseudo-random data with files written at
+// the specified offsets.
+func carveTestImage(size int64, files map[int64][]byte) []byte {
+	img := make([]byte, size)
+	r := rand.New(rand.NewPCG(3, 4))
+	for i := range img {
+		if r.IntN(4) != 0 {
+			img[i] = byte(r.Uint32())
+		}
+	}
+	for off, f := range files {
+		copy(img[off:], f)
+	}
+	return img
+}
+
+// carveTestReader counts the reads from r.
+type carveTestReader struct {
+	r     *bytes.Reader
+	n     atomic.Int64
+	bytes atomic.Int64
+}
+
+func (c *carveTestReader) ReadAt(p []byte, off int64) (int, error) {
+	c.n.Add(1)
+	c.bytes.Add(int64(len(p)))
+	return c.r.ReadAt(p, off)
+}
+
+// chunks returns the number of bytes read in 4096-byte chunks.
+func (c *carveTestReader) chunks() int64 {
+	return c.bytes.Load() / 4096
+}
@@ -2,12 +2,14 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -21,6 +23,12 @@ var (
 	OutputFormat = pflag.StringP("output-format", "O", "bookmarks.{input.basename}-{match.offset}.{bookmarks.checksum}.json", "output file format")
 	Quiet        = pflag.BoolP("quiet", "q", false, "don't show information about the recovered files")
 	JSON         = pflag.BoolP("json", "j", false, "show information about the recovered files as JSON")
+	Workers      = pflag.IntP("workers", "w", 0, "number of chunks to scan concurrently (0 for the number of CPUs)")
+	ChunkSize    = pflag.Int64("chunk-size", 4*1024*1024, "number of bytes to scan at a time")
+	MaxSize      = pflag.Int64("max-size", 20*1024*1024, "maximum size of a bookmarks file")
+	Signatures   = pflag.StringSliceP("signatures", "g", []string{"all"}, "signatures to search for (prefix with - to exclude)")
+	Salvage      = pflag.BoolP("salvage", "s", false, "also recover what's intact from truncated, corrupted, invalid, or checksum-failing bookmarks")
+	SalvageFmt   = pflag.StringP("salvage-output-format", "S", "salvaged.{input.basename}-{match.offset}.{bookmarks.checksum}.json", "output file format for salvaged bookmarks")
 	Help         = pflag.BoolP("help", "h", false, "show this help text")
 )
 
@@ -31,6 +39,11 @@ func main() {
 
 	if pflag.NArg() < 1 || *Help {
 		fmt.Printf("Usage: %s [options] file[:[start_offset][:[end_offset]|+length]]...\n\nOptions:\n%s", os.Args[0], pflag.CommandLine.FlagUsages())
+		fmt.Printf("\nUse - as the file to read from stdin. Stdin and other pipes are read\n")
+		fmt.Printf("sequentially.\n")
+		fmt.Printf("\nMemory use is about workers*(chunk-size + max-size) plus the matches not yet\n")
+		fmt.Printf("written, and 2*max-size more for the window when reading pipes (about 24 MiB\n")
+		fmt.Printf("per worker plus 40 MiB by default).\n")
 		fmt.Printf("\nOutput Fields (--output-format, --json):\n")
 		fmt.Printf("  %-24s   %s\n", "input.path", "input file path")
 		fmt.Printf("  %-24s   %s\n", "input.basename", "input file basename")
@@ -43,22 +56,57 @@ func main() {
 		fmt.Printf("  %-24s   %s\n", "bookmarks.date.yyyymmdd", "most recent data (yyyymmdd)")
 		fmt.Printf("  %-24s   %s\n", "bookmarks.count.folders", "number of folders")
 		fmt.Printf("  %-24s   %s\n", "bookmarks.count.urls", "number of bookmarks")
+		fmt.Printf("  %-24s   %s\n", "salvage.truncated", "whether the salvaged json was incomplete (--json only)")
+		fmt.Printf("  %-24s   %s\n", "salvage.checksum_mismatch", "whether the salvaged json had an invalid checksum (--json only)")
+		fmt.Printf("  %-24s   %s\n", "salvage.decode_error", "error from strictly decoding the complete salvaged json (--json only)")
+		fmt.Printf("  %-24s   %s\n", "salvage.recovered", "number of salvaged folders and bookmarks (--json only)")
+		fmt.Printf("  %-24s   %s\n", "salvage.checksum", "original checksum of the salvaged json (--json only)")
 		fmt.Printf("  %-24s   %s\n", "output", "output file basename (not for --output-format)")
+		fmt.Printf("\nSignatures (--signatures):\n")
+		fmt.Printf("  %-24s   %s\n", "chrome", "files written by Chrome or crb")
+		fmt.Printf("  %-24s   %s\n", "chrome-crlf", "files written by Chrome or crb with CRLF line endings")
+		fmt.Printf("  %-24s   %s\n", "compact", "minified json")
+		fmt.Printf("  %-24s   %s\n", "json", "json with any whitespace between the first keys")
+		fmt.Printf("  %-24s   %s\n", "all", "all of the above")
+		fmt.Printf("\nSalvaged bookmarks have the intact folders and bookmarks, missing permanent\n")
+		fmt.Printf("folders, and a new checksum. They are written as re-encoded json, and the\n")
+		fmt.Printf("salvage field is only present for them.\n")
 		if !*Help {
 			os.Exit(2)
 		}
 		return
 	}
 
-	if *OutputFormat == "" {
-		fmt.Fprintf(os.Stderr, "fatal: output format is empty\n")
+	if *Workers < 0 {
+		fmt.Fprintf(os.Stderr, "fatal: invalid worker count\n")
 		os.Exit(2)
 	}
-	if fnCharRe.MatchString(*OutputFormat) {
-		fmt.Fprintf(os.Stderr, "fatal: output format contains invalid characters\n")
+	if *ChunkSize <= 0 {
+		fmt.Fprintf(os.Stderr, "fatal: invalid chunk size\n")
+		os.Exit(2)
+	}
+	if *MaxSize <= 0 {
+		fmt.Fprintf(os.Stderr, "fatal: invalid max size\n")
 		os.Exit(2)
 	}
 
+	sigs, err := parseSignatures(*Signatures)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: invalid --signatures value: %v\n", err)
+		os.Exit(2)
+	}
+
+	for _, f := range []string{*OutputFormat, *SalvageFmt} {
+		if f == "" {
+			fmt.Fprintf(os.Stderr, "fatal: output format is empty\n")
+			os.Exit(2)
+		}
+		if fnCharRe.MatchString(f) {
+			fmt.Fprintf(os.Stderr, "fatal: output format contains invalid characters\n")
+			os.Exit(2)
+		}
+	}
+
 	if *Output != "" {
 		if err := os.MkdirAll(*Output, 0777); err != nil {
 			fmt.Fprintf(os.Stderr, "fatal: failed to create output dir: %v\n", err)
@@ -91,6 +139,10 @@ func main() {
 				length = 1<<63 - 1
 			}
 		}
+		if path == "-" && slices.Contains(iPath, "-") {
+			fmt.Fprintf(os.Stderr, "fatal: stdin can only be carved once\n")
+			os.Exit(2)
+		}
 		iPath = append(iPath, path)
 		iOff = append(iOff, offset)
 		iLen = append(iLen, length)
@@ -98,7 +150,7 @@ func main() {
 
 	var fail bool
 	for i := range iPath {
-		if err := carve(iPath[i], iOff[i], iLen[i]); err != nil {
+		if err := carve(iPath[i], iOff[i], iLen[i], sigs); err != nil {
 			fmt.Fprintf(os.Stderr, "error: failed to carve %q: %v\n", iPath[i], err)
 			fail = true
 		}
@@ -108,110 +160,227 @@ func main() {
 	}
 }
 
-func carve(path string, offset, length int64) error {
-	f, err := os.Open(path)
+func carve(path string, offset, length int64, sigs []crb.CarveSignature) error {
+	f := os.Stdin
+	if path != "-" {
+		var err error
+		if f, err = os.Open(path); err != nil {
+			return err
+		}
+		defer f.Close()
+	}
+
+	opt := crb.CarveOptions{
+		Workers:    *Workers,
+		ChunkSize:  *ChunkSize,
+		MaxSize:    *MaxSize,
+		Signatures: sigs,
+	}
+	if *Salvage {
+		opt.Salvage = func(off int64, buf []byte, s *crb.Salvaged) error {
+			return match(path, offset+off, buf, s.Bookmarks, s)
+		}
+	}
+	fn := func(off int64, buf []byte, b *crb.Bookmarks) error {
+		return match(path, offset+off, buf, b, nil)
+	}
+
+	fi, err := f.Stat()
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-
-	r := io.NewSectionReader(f, offset, length)
 
-	return crb.Carve(r, func(off int64, buf []byte, b *crb.Bookmarks) error {
-		var t crb.Time
-		var cf, cb int
-		b.Walk(func(n crb.BookmarkNode, parents ...string) error {
-			switch n.Type {
-			case crb.NodeTypeFolder:
-				cf++
-			case crb.NodeTypeURL:
-				cb++
-			}
-			if v := n.DateAdded; v > t {
-				t = v
-			}
-			if v := n.DateLastUsed; v > t {
-				t = v
+	// pipes can't be read at arbitrary offsets, so stream them instead
+	if path == "-" || fi.Mode()&(os.ModeNamedPipe|os.ModeSocket|os.ModeCharDevice) != 0 {
+		if _, err := io.CopyN(io.Discard, f, offset); err != nil {
+			if err == io.EOF {
+				return nil
 			}
-			if v := n.DateModified; v > t {
-				t = v
+			return fmt.Errorf("skip to offset: %w", err)
+		}
+		return opt.CarveReader(io.LimitReader(f, length), fn)
+	}
+
+	// note: block devices have a zero size, so only use it for regular files
+	size := int64(-1)
+	if fi.Mode().IsRegular() {
+		size = max(fi.Size()-offset, 0)
+	}
+	if size < 0 || length < size {
+		size = length
+	}
+	return opt.Carve(io.NewSectionReader(f, offset, length), size, fn)
+}
+
+// parseSignatures parses a list of signature names, where names prefixed with
+// - are excluded.
+func parseSignatures(names []string) ([]crb.CarveSignature, error) {
+	use := map[string]bool{}
+	for _, n := range names {
+		n, exclude := strings.CutPrefix(n, "-")
+		var found bool
+		for _, s := range crb.CarveSignatures {
+			if n == "all" || n == s.Name {
+				use[s.Name] = !exclude
+				found = true
 			}
-			return nil
-		})
-
-		var m struct {
-			Input struct {
-				Path     string `json:"path"`
-				Basename string `json:"basename"`
-			} `json:"input"`
-			Match struct {
-				Offset int64 `json:"offset"`
-				Length int64 `json:"length"`
-			} `json:"match"`
-			Bookmarks struct {
-				BarGUID  string `json:"barguid"`
-				Checksum string `json:"checksum"`
-				Date     struct {
-					Unix      int64  `json:"unix"`
-					UnixMicro int64  `json:"unixmicro"`
-					YYYYMMDD  string `json:"yyyymmdd"`
-				} `json:"date"`
-				Count struct {
-					Folder int `json:"folders"`
-					URL    int `json:"urls"`
-				} `json:"count"`
-			} `json:"bookmarks"`
-			Output string `json:"output,omitempty"`
-		}
-
-		m.Input.Path = path
-		m.Input.Basename = filepath.Base(path)
-		m.Match.Offset = off + offset
-		m.Match.Length = int64(len(buf))
-		m.Bookmarks.BarGUID = b.Roots.BookmarkBar.GUID.String()
-		m.Bookmarks.Checksum = b.Checksum
-		m.Bookmarks.Date.Unix = t.Unix()
-		m.Bookmarks.Date.UnixMicro = t.UnixMicro()
-		m.Bookmarks.Date.YYYYMMDD = t.Time().Format("20060102")
-		m.Bookmarks.Count.Folder = cf
-		m.Bookmarks.Count.URL = cb
-
-		if *Output != "" {
-			m.Output = strings.NewReplacer(
-				"{input.path}", fnCharRe.ReplaceAllLiteralString(m.Input.Path, "_"),
-				"{input.basename}", fnCharRe.ReplaceAllLiteralString(m.Input.Basename, "_"),
-				"{match.offset}", strconv.FormatInt(m.Match.Offset, 10),
-				"{match.length}", strconv.FormatInt(m.Match.Length, 10),
-				"{bookmarks.barguid}", m.Bookmarks.BarGUID,
-				"{bookmarks.checksum}", m.Bookmarks.Checksum,
-				"{bookmarks.date.unix}", strconv.FormatInt(m.Bookmarks.Date.Unix, 10),
-				"{bookmarks.date.unixmicro}", strconv.FormatInt(m.Bookmarks.Date.UnixMicro, 10),
-				"{bookmarks.date.yyyymmdd}", m.Bookmarks.Date.YYYYMMDD,
-				"{bookmarks.count.folders}", strconv.Itoa(m.Bookmarks.Count.Folder),
-				"{bookmarks.count.urls}", strconv.Itoa(m.Bookmarks.Count.URL),
-			).Replace(*OutputFormat)
-		}
-
-		if !*Quiet {
-			if *JSON {
-				enc := json.NewEncoder(os.Stdout)
-				enc.SetEscapeHTML(false)
-				enc.Encode(m)
-			} else {
-				var o string
-				if m.Output != "" {
-					o = " -> " + m.Output
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown signature %q", n)
+		}
+	}
+	var sigs []crb.CarveSignature
+	for _, s := range crb.CarveSignatures {
+		if use[s.Name] {
+			sigs = append(sigs, s)
+		}
+	}
+	if len(sigs) == 0 {
+		return nil, fmt.Errorf("no signatures selected")
+	}
+	return sigs, nil
+}
+
+// match reports and writes bookmarks found at off in path. If s is not nil,
+// the bookmarks were salvaged.
+func match(path string, off int64, buf []byte, b *crb.Bookmarks, s *crb.Salvaged) error {
+	var t crb.Time
+	var cf, cb int
+	b.Walk(func(n crb.BookmarkNode, parents ...string) error {
+		switch n.Type {
+		case crb.NodeTypeFolder:
+			cf++
+		case crb.NodeTypeURL:
+			cb++
+		}
+		if v := n.DateAdded; v > t {
+			t = v
+		}
+		if v := n.DateLastUsed; v > t {
+			t = v
+		}
+		if v := n.DateModified; v > t {
+			t = v
+		}
+		return nil
+	})
+
+	var m struct {
+		Input struct {
+			Path     string `json:"path"`
+			Basename string `json:"basename"`
+		} `json:"input"`
+		Match struct {
+			Offset int64 `json:"offset"`
+			Length int64 `json:"length"`
+		} `json:"match"`
+		Bookmarks struct {
+			BarGUID  string `json:"barguid"`
+			Checksum string `json:"checksum"`
+			Date     struct {
+				Unix      int64  `json:"unix"`
+				UnixMicro int64  `json:"unixmicro"`
+				YYYYMMDD  string `json:"yyyymmdd"`
+			} `json:"date"`
+			Count struct {
+				Folder int `json:"folders"`
+				URL    int `json:"urls"`
+			} `json:"count"`
+		} `json:"bookmarks"`
+		Salvage *struct {
+			Truncated        bool   `json:"truncated"`
+			ChecksumMismatch bool   `json:"checksum_mismatch"`
+			DecodeError      string `json:"decode_error"`
+			Recovered        int    `json:"recovered"`
+			Checksum         string `json:"checksum"`
+		} `json:"salvage,omitempty"`
+		Output string `json:"output,omitempty"`
+	}
+
+	m.Input.Path = path
+	m.Input.Basename = filepath.Base(path)
+	m.Match.Offset = off
+	m.Match.Length = int64(len(buf))
+	m.Bookmarks.BarGUID = b.Roots.BookmarkBar.GUID.String()
+	m.Bookmarks.Checksum = b.Checksum
+	m.Bookmarks.Date.Unix = t.Unix()
+	m.Bookmarks.Date.UnixMicro = t.UnixMicro()
+	m.Bookmarks.Date.YYYYMMDD = t.Time().Format("20060102")
+	m.Bookmarks.Count.Folder = cf
+	m.Bookmarks.Count.URL = cb
+	if s != nil {
+		m.Salvage = &struct {
+			Truncated        bool   `json:"truncated"`
+			ChecksumMismatch bool   `json:"checksum_mismatch"`
+			DecodeError      string `json:"decode_error"`
+			Recovered        int    `json:"recovered"`
+			Checksum         string `json:"checksum"`
+		}{s.Truncated, s.ChecksumMismatch, "", s.Recovered, s.Checksum}
+		if s.DecodeErr != nil {
+			m.Salvage.DecodeError = s.DecodeErr.Error()
+		}
+	}
+
+	if *Output != "" {
+		format := *OutputFormat
+		if s != nil {
+			format = *SalvageFmt
+		}
+		m.Output = strings.NewReplacer(
+			"{input.path}", fnCharRe.ReplaceAllLiteralString(m.Input.Path, "_"),
+			"{input.basename}", fnCharRe.ReplaceAllLiteralString(m.Input.Basename, "_"),
+			"{match.offset}", strconv.FormatInt(m.Match.Offset, 10),
+			"{match.length}", strconv.FormatInt(m.Match.Length, 10),
+			"{bookmarks.barguid}", m.Bookmarks.BarGUID,
+			"{bookmarks.checksum}", m.Bookmarks.Checksum,
+			"{bookmarks.date.unix}", strconv.FormatInt(m.Bookmarks.Date.Unix, 10),
+			"{bookmarks.date.unixmicro}", strconv.FormatInt(m.Bookmarks.Date.UnixMicro, 10),
+			"{bookmarks.date.yyyymmdd}", m.Bookmarks.Date.YYYYMMDD,
+			"{bookmarks.count.folders}", strconv.Itoa(m.Bookmarks.Count.Folder),
+			"{bookmarks.count.urls}", strconv.Itoa(m.Bookmarks.Count.URL),
+		).Replace(format)
+	}
+
+	if !*Quiet {
+		if *JSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetEscapeHTML(false)
+			enc.Encode(m)
+		} else {
+			var o string
+			if s != nil {
+				var x []string
+				if s.Truncated {
+					x = append(x, "truncated")
+				}
+				if s.ChecksumMismatch {
+					x = append(x, "checksum mismatch")
 				}
-				fmt.Fprintf(os.Stdout, "%s:%d+%d [%s @ %s] %s (%d,%d)%s\n", m.Input.Path, m.Match.Offset, m.Match.Length, m.Bookmarks.BarGUID, t.Time().Format("02 Jan 06 15:04 MST"), m.Bookmarks.Checksum, m.Bookmarks.Count.Folder, m.Bookmarks.Count.URL, o)
+				if s.DecodeErr != nil {
+					x = append(x, "invalid: "+s.DecodeErr.Error())
+				}
+				x = append(x, strconv.Itoa(s.Recovered)+" recovered")
+				o += " {salvaged: " + strings.Join(x, ", ") + "}"
+			}
+			if m.Output != "" {
+				o += " -> " + m.Output
 			}
+			fmt.Fprintf(os.Stdout, "%s:%d+%d [%s @ %s] %s (%d,%d)%s\n", m.Input.Path, m.Match.Offset, m.Match.Length, m.Bookmarks.BarGUID, t.Time().Format("02 Jan 06 15:04 MST"), m.Bookmarks.Checksum, m.Bookmarks.Count.Folder, m.Bookmarks.Count.URL, o)
 		}
+	}
 
-		if *Output != "" {
-			if err := os.WriteFile(filepath.Join(*Output, m.Output), buf, 0666); err != nil {
-				return fmt.Errorf("write output: %w", err)
+	if *Output != "" {
+		if s != nil {
+			var bb bytes.Buffer
+			if err := crb.Encode(&bb, s.Bookmarks); err != nil {
+				return fmt.Errorf("encode salvaged bookmarks: %w", err)
 			}
+			buf = bb.Bytes()
 		}
+		if err := os.WriteFile(filepath.Join(*Output, m.Output), buf, 0666); err != nil {
+			return fmt.Errorf("write output: %w", err)
+		}
+	}
 
-		return nil
-	})
+	return nil
 }
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pgaskin/crb"
+	"github.com/pgaskin/crb/urlnorm"
+	"github.com/spf13/pflag"
+)
+
+func dedupe(args []string) {
+	fs := pflag.NewFlagSet("dedupe", pflag.ExitOnError)
+	perFolder := fs.BoolP("per-folder", "p", false, "only consider bookmarks in the same folder to be duplicates")
+	normalize := fs.StringP("normalize", "n", "default,fragment", "url normalization rules for comparison (see crb normalize --help)")
+	keep := fs.StringP("keep", "k", "oldest", "which duplicate to keep (oldest, newest)")
+	keepFolders := fs.Bool("keep-folders", false, "don't merge sibling folders with the same name")
+	keepEmpty := fs.Bool("keep-empty", false, "don't remove empty folders")
+	write := fs.BoolP("write", "w", false, "rewrite the bookmarks file instead of reporting duplicates")
+	output := fs.StringP("output", "o", "", "write the deduplicated bookmarks to the specified file (- for stdout) instead of rewriting it (implies --write)")
+	help := fs.BoolP("help", "h", false, "show this help text")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || *help {
+		fmt.Printf("Usage: %s dedupe [options] bookmarks_file\n\nOptions:\n%s", os.Args[0], fs.FlagUsages())
+		fmt.Printf("\nBookmarks are duplicates if their urls are the same after normalization. When\n")
+		fmt.Printf("rewriting, duplicate folders are merged first, then duplicate bookmarks are\n")
+		fmt.Printf("removed, then empty folders are removed.\n")
+		if !*help {
+			os.Exit(2)
+		}
+		return
+	}
+
+	rules, err := urlnorm.ParseRules(*normalize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: invalid --normalize value: %v\n", err)
+		os.Exit(2)
+	}
+
+	opt := crb.DedupeOptions{
+		PerFolder:   *perFolder,
+		Normalize:   rules.Normalize,
+		KeepFolders: *keepFolders,
+		KeepEmpty:   *keepEmpty,
+	}
+	switch *keep {
+	case "oldest":
+	case "newest":
+		opt.KeepNewest = true
+	default:
+		fmt.Fprintf(os.Stderr, "fatal: invalid --keep value %q\n", *keep)
+		os.Exit(2)
+	}
+
+	b, _, crlf, _, err := decode(fs.Arg(0), true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !*write && *output == "" {
+		d := opt.Find(b)
+		for _, g := range d.URLs {
+			fmt.Printf("duplicate url %s\n", g.Key)
+			dedupeGroup(g)
+		}
+		if !opt.KeepFolders {
+			for _, g := range d.Folders {
+				fmt.Printf("duplicate folder %s\n", g.Key)
+				dedupeGroup(g)
+			}
+		}
+		if !opt.KeepEmpty {
+			for _, n := range d.Empty {
+				fmt.Printf("empty folder %s\n", n.Path)
+			}
+		}
+		return
+	}
+
+	c := opt.Dedupe(b)
+
+	fn := *output
+	if fn == "" {
+		fn = fs.Arg(0)
+	}
+	if err := save(fn, b, crlf); err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: write bookmarks: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Merged %d folders, removed %d bookmarks and %d empty folders.\n", c.Folders, c.URLs, c.Empty)
+}
+
+func dedupeGroup(g crb.DuplicateGroup) {
+	for i, n := range g.Nodes {
+		a := "remove"
+		if i == g.Keep {
+			a = "keep  "
+		}
+		fmt.Printf("  %s %s  %s\n", a, n.DateAdded.Time().Format("2006-01-02"), n.Path)
+	}
+}
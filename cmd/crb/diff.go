@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pgaskin/crb"
+	"github.com/pgaskin/crb/urlnorm"
+	"github.com/spf13/pflag"
+)
+
+func diff(args []string) {
+	fs := pflag.NewFlagSet("diff", pflag.ExitOnError)
+	jsn := fs.BoolP("json", "j", false, "write the changes as json")
+	normalize := fs.StringP("normalize", "n", "", "ignore url changes which don't change the url after normalization (see crb normalize --help)")
+	help := fs.BoolP("help", "h", false, "show this help text")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 || *help {
+		fmt.Printf("Usage: %s diff [options] old_bookmarks_file new_bookmarks_file\n\nOptions:\n%s", os.Args[0], fs.FlagUsages())
+		fmt.Printf("\nNodes are matched by GUID, or by ID if they don't have one. Exits with status 1\n")
+		fmt.Printf("if there are differences, like diff(1).\n")
+		if !*help {
+			os.Exit(2)
+		}
+		return
+	}
+
+	var opt crb.DiffOptions
+	if *normalize != "" {
+		rules, err := urlnorm.ParseRules(*normalize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: invalid --normalize value: %v\n", err)
+			os.Exit(2)
+		}
+		opt.NormalizeURL = rules.Normalize
+	}
+
+	var bs [2]*crb.Bookmarks
+	for i, fn := range fs.Args() {
+		b, _, _, _, err := decode(fn, true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: %s: %v\n", fn, err)
+			os.Exit(2)
+		}
+		bs[i] = b
+	}
+
+	cs := opt.Diff(bs[0], bs[1])
+	if *jsn {
+		type change struct {
+			Kind     crb.ChangeKind `json:"kind"`
+			GUID     crb.GUID       `json:"guid"`
+			ID       int            `json:"id"`
+			OldPath  string         `json:"old_path,omitempty"`
+			NewPath  string         `json:"new_path,omitempty"`
+			OldIndex int            `json:"old_index"`
+			NewIndex int            `json:"new_index"`
+			Key      string         `json:"key,omitempty"`
+			Old      *string        `json:"old,omitempty"`
+			New      *string        `json:"new,omitempty"`
+		}
+		js := []change{}
+		for _, c := range cs {
+			j := change{
+				Kind:     c.Kind,
+				OldPath:  c.OldPath,
+				NewPath:  c.NewPath,
+				OldIndex: c.OldIndex,
+				NewIndex: c.NewIndex,
+				Key:      c.Key,
+			}
+			if c.New != nil {
+				j.GUID, j.ID = c.New.GUID, c.New.ID
+			} else {
+				j.GUID, j.ID = c.Old.GUID, c.Old.ID
+			}
+			switch c.Kind {
+			case crb.ChangeRenamed, crb.ChangeURL:
+				j.Old, j.New = &c.OldValue, &c.NewValue
+			case crb.ChangeMeta:
+				if _, ok := c.Old.MetaInfo[c.Key]; ok {
+					j.Old = &c.OldValue
+				}
+				if _, ok := c.New.MetaInfo[c.Key]; ok {
+					j.New = &c.NewValue
+				}
+			}
+			js = append(js, j)
+		}
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		if err := e.Encode(js); err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+			os.Exit(2)
+		}
+	} else if len(cs) != 0 {
+		fmt.Printf("--- %s\n+++ %s\n", fs.Arg(0), fs.Arg(1))
+		diffText(os.Stdout, cs)
+	}
+
+	if len(cs) != 0 {
+		os.Exit(1)
+	}
+}
+
+// diffText writes the changes with added and removed subtrees expanded.
+func diffText(w io.Writer, cs []crb.Change) {
+	// nodes moved into an added folder or out of a removed one are within its
+	// subtree, but they're shown as moves instead
+	moved := map[*crb.BookmarkNode]bool{}
+	for _, c := range cs {
+		if c.Kind == crb.ChangeMoved {
+			moved[c.Old], moved[c.New] = true, true
+		}
+	}
+	for _, c := range cs {
+		switch c.Kind {
+		case crb.ChangeRemoved:
+			diffTree(w, "-", c.OldPath, c.Old, moved)
+		case crb.ChangeAdded:
+			diffTree(w, "+", c.NewPath, c.New, moved)
+		default:
+			fmt.Fprintf(w, "~ %s\n", c)
+		}
+	}
+}
+
+// diffTree writes n and its descendants other than the skipped ones with the
+// specified prefix.
+func diffTree(w io.Writer, prefix, path string, n *crb.BookmarkNode, skip map[*crb.BookmarkNode]bool) {
+	if n.Type == crb.NodeTypeFolder {
+		fmt.Fprintf(w, "%s %s/\n", prefix, path)
+	} else {
+		fmt.Fprintf(w, "%s %s\t%s\n", prefix, path, n.URL)
+	}
+	if n.Children != nil {
+		for i, e := range crb.PathElements(*n.Children) {
+			if c := &(*n.Children)[i]; !skip[c] {
+				diffTree(w, prefix, path+"/"+e, c, skip)
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/pgaskin/crb"
+)
+
+func TestDiffText(t *testing.T) {
+	a, err := crb.Import(strings.NewReader(`<DL>
+<DT><H3 PERSONAL_TOOLBAR_FOLDER="true">Bookmarks bar</H3>
+<DL>
+	<DT><H3>A</H3>
+	<DL>
+		<DT><A HREF="https://example.com/a1">a1</A>
+	</DL>
+	<DT><H3>B</H3>
+	<DL>
+		<DT><A HREF="https://example.com/b1">b1</A>
+		<DT><H3>C</H3>
+		<DL>
+			<DT><A HREF="https://example.com/c1">c1</A>
+		</DL>
+		<DT><A HREF="https://example.com/b2">b2</A>
+	</DL>
+</DL>
+</DL>`))
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+
+	var b crb.Bookmarks
+	if buf, err := json.Marshal(a); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(buf, &b); err != nil {
+		t.Fatal(err)
+	}
+	lookup := func(p string) *crb.BookmarkNode {
+		n, err := b.Lookup(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	f, err := b.InsertAt(&b.Roots.BookmarkBar, -1, crb.BookmarkNode{Type: crb.NodeTypeFolder, Name: "F", GUID: crb.NewGUID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.InsertAt(f, -1, crb.BookmarkNode{Type: crb.NodeTypeURL, Name: "f1", URL: "https://example.com/f1", GUID: crb.NewGUID()}); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range [][2]string{
+		{"Bookmarks bar/A/a1", "Bookmarks bar/F"},
+		{"Bookmarks bar/B/C/c1", "Bookmarks bar/A"},
+		{"Bookmarks bar/B/b1", "Bookmarks bar/F"},
+	} {
+		if _, err := b.Move(lookup(m[0]), lookup(m[1]), -1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Remove(lookup("Bookmarks bar/B")); err != nil {
+		t.Fatal(err)
+	}
+
+	var w strings.Builder
+	diffText(&w, crb.Diff(a, &b))
+	exp := strings.Join([]string{
+		"- Bookmarks bar/B/",
+		"- Bookmarks bar/B/C/",
+		"- Bookmarks bar/B/b2\thttps://example.com/b2",
+		"~ moved Bookmarks bar/B/C/c1 to Bookmarks bar/A/c1",
+		"+ Bookmarks bar/F/",
+		"+ Bookmarks bar/F/f1\thttps://example.com/f1",
+		"~ moved Bookmarks bar/A/a1 to Bookmarks bar/F/a1",
+		"~ moved Bookmarks bar/B/b1 to Bookmarks bar/F/b1",
+	}, "\n") + "\n"
+	if act := w.String(); act != exp {
+		t.Errorf("got:\n%s\nexpected:\n%s", act, exp)
+	}
+}
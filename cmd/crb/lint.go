@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pgaskin/crb"
+	"github.com/spf13/pflag"
+)
+
+func lint(args []string) {
+	fs := pflag.NewFlagSet("lint", pflag.ExitOnError)
+	noWarn := fs.BoolP("no-warnings", "w", false, "don't show warnings")
+	strict := fs.BoolP("strict", "s", false, "exit with status 1 for warnings too")
+	help := fs.BoolP("help", "h", false, "show this help text")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 || *help {
+		fmt.Printf("Usage: %s lint [options] bookmarks_file...\n\nOptions:\n%s", os.Args[0], fs.FlagUsages())
+		fmt.Printf("\nExit Status:\n")
+		fmt.Printf("  %-24s   %s\n", "0", "no problems")
+		fmt.Printf("  %-24s   %s\n", "1", "errors (or warnings with --strict) were found, or a file could not be read")
+		fmt.Printf("  %-24s   %s\n", "2", "invalid arguments")
+		fmt.Printf("  %-24s   %s\n", "3", "only warnings were found")
+		if !*help {
+			os.Exit(2)
+		}
+		return
+	}
+
+	var nerr, nwarn int
+	for _, fn := range fs.Args() {
+		b, _, _, _, err := decode(fn, true)
+		if err != nil {
+			fmt.Printf("%s: fatal: %v\n", fn, err)
+			nerr++
+			continue
+		}
+		for _, p := range b.Validate() {
+			switch p.Severity {
+			case crb.SeverityWarning:
+				nwarn++
+				if *noWarn {
+					continue
+				}
+			default:
+				nerr++
+			}
+			fmt.Printf("%s: %s\n", fn, p)
+		}
+	}
+
+	switch {
+	case nerr != 0, nwarn != 0 && *strict:
+		os.Exit(1)
+	case nwarn != 0:
+		os.Exit(3)
+	}
+}
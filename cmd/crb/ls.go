@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pgaskin/crb"
+	"github.com/spf13/pflag"
+)
+
+func ls(args []string) {
+	fs := pflag.NewFlagSet("ls", pflag.ExitOnError)
+	dir := fs.BoolP("directory", "d", false, "list folders themselves, not their contents")
+	glob := fs.BoolP("glob", "g", false, "treat paths as glob patterns (* and ? match within a name, ** matches any number of folders)")
+	long := fs.BoolP("long", "l", false, "show the type, id, date added, guid, and url")
+	help := fs.BoolP("help", "h", false, "show this help text")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 || *help {
+		fmt.Printf("Usage: %s ls [options] bookmarks_file [path...]\n\nOptions:\n%s", os.Args[0], fs.FlagUsages())
+		fmt.Printf("\nPaths are slash-separated names starting with the permanent folder (e.g.,\n")
+		fmt.Printf("'Bookmarks bar/Work'). Use a backslash to escape special characters in names,\n")
+		fmt.Printf("and add [n] to select the nth of multiple siblings with the same name.\n")
+		if !*help {
+			os.Exit(2)
+		}
+		return
+	}
+
+	b, _, _, _, err := decode(fs.Arg(0), true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(1)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer tw.Flush()
+
+	entry := func(n *crb.BookmarkNode, name string) {
+		if n.Type == crb.NodeTypeFolder {
+			name += "/"
+		}
+		if !*long {
+			fmt.Fprintf(tw, "%s\n", name)
+			return
+		}
+		t := "-"
+		if n.Type == crb.NodeTypeFolder {
+			t = "d"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\n", t, n.ID, n.DateAdded.Time().Format("2006-01-02"), n.GUID, name, n.URL)
+	}
+
+	list := func(n *crb.BookmarkNode, path string) {
+		if *dir || n.Type != crb.NodeTypeFolder {
+			entry(n, path)
+			return
+		}
+		if n.Children != nil {
+			for i, e := range crb.PathElements(*n.Children) {
+				entry(&(*n.Children)[i], e)
+			}
+		}
+	}
+
+	paths := fs.Args()[1:]
+	if len(paths) == 0 {
+		for _, r := range []*crb.BookmarkNode{&b.Roots.BookmarkBar, &b.Roots.Other, &b.Roots.MobileBookmark} {
+			entry(r, crb.EscapePathElement(r.Name))
+		}
+		return
+	}
+
+	var fail bool
+	for i, p := range paths {
+		if *glob {
+			ns, ps, err := b.GlobPaths(p)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: glob %q: %v\n", p, err)
+				fail = true
+				continue
+			}
+			if len(ns) == 0 {
+				fmt.Fprintf(os.Stderr, "error: glob %q: no matches\n", p)
+				fail = true
+			}
+			for j, n := range ns {
+				entry(n, ps[j])
+			}
+			continue
+		}
+		n, err := b.Lookup(p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			fail = true
+			continue
+		}
+		if len(paths) > 1 && !*dir && n.Type == crb.NodeTypeFolder {
+			if i != 0 {
+				fmt.Fprintf(tw, "\n")
+			}
+			fmt.Fprintf(tw, "%s:\n", strings.TrimSuffix(p, "/"))
+		}
+		list(n, p)
+	}
+	if fail {
+		tw.Flush()
+		os.Exit(1)
+	}
+}
@@ -2,9 +2,13 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/pgaskin/crb"
@@ -12,36 +16,163 @@ import (
 )
 
 var (
-	Export  = pflag.StringArrayP("export", "E", nil, "export bookmarks HTML to the specified file (- for stdout)")
-	Tree    = pflag.BoolP("tree", "t", false, "write the bookmarks tree to stdout (use --verbose to show dates)")
-	Verbose = pflag.BoolP("verbose", "v", false, "show additional information")
-	Quiet   = pflag.BoolP("quiet", "q", false, "don't write info about the bookmarks file to stderr")
-	Help    = pflag.BoolP("help", "h", false, "show this help text")
+	Export    = pflag.StringArrayP("export", "E", nil, "export bookmarks HTML to the specified file (- for stdout)")
+	Tree      = pflag.BoolP("tree", "t", false, "write the bookmarks tree to stdout (use --verbose to show dates)")
+	TreeFmt   = pflag.String("tree-format", "text", "tree format (text, json)")
+	TreeRoot  = pflag.String("tree-root", "", "only write the tree of the folder at the specified path")
+	TreeDepth = pflag.Int("tree-depth", 0, "maximum depth of the tree (0 for unlimited)")
+	TreeCols  = pflag.StringSlice("tree-columns", nil, "additional columns to show in the tree (id, guid, date, meta)")
+	ASCII     = pflag.Bool("ascii", false, "draw the tree using ascii characters")
+	Color     = pflag.String("color", "auto", "when to use colors (auto, always, never) (auto respects NO_COLOR)")
+	Lenient   = pflag.BoolP("lenient", "l", false, "allow unknown fields in the bookmarks file (use --verbose to list them)")
+	Fix       = pflag.BoolP("fix-checksum", "F", false, "rewrite the bookmarks file with the correct checksum if it is invalid (writes to stdout if reading from stdin)")
+	Verbose   = pflag.BoolP("verbose", "v", false, "show additional information")
+	Quiet     = pflag.BoolP("quiet", "q", false, "don't write info about the bookmarks file to stderr")
+	Format    = pflag.String("format", "text", "info format (text: human-readable to stderr, json: same schema as crb-carve --json to stdout)")
+	JSON      = pflag.BoolP("json", "j", false, "shorthand for --format=json")
+	Help      = pflag.BoolP("help", "h", false, "show this help text")
 )
 
+// commands are subcommands of crb. They parse their own arguments.
+var commands = []struct {
+	Name string
+	Desc string
+	Main func(args []string)
+}{
+	{"dedupe", "find and remove duplicate bookmarks", dedupe},
+	{"diff", "compare bookmarks files", diff},
+	{"lint", "check bookmarks files for problems", lint},
+	{"ls", "list bookmarks by path", ls},
+	{"merge", "merge changes to bookmarks files", merge},
+	{"normalize", "normalize bookmark urls", normalize},
+	{"search", "find bookmarks matching a query", search},
+	{"sort", "sort bookmarks", sortBookmarks},
+	{"stats", "show statistics about bookmarks", stats},
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		for _, c := range commands {
+			if c.Name == os.Args[1] {
+				c.Main(os.Args[2:])
+				return
+			}
+		}
+	}
+
 	pflag.Parse()
 
 	if pflag.NArg() != 1 || *Help {
-		fmt.Printf("Usage: %s [options] bookmarks_file\n\nOptions:\n%s", os.Args[0], pflag.CommandLine.FlagUsages())
+		fmt.Printf("Usage: %s [options] bookmarks_file\n       %s command [options] args...\n\nOptions:\n%s", os.Args[0], os.Args[0], pflag.CommandLine.FlagUsages())
+		fmt.Printf("\nCommands (use --help for more information):\n")
+		for _, c := range commands {
+			fmt.Printf("  %-24s   %s\n", c.Name, c.Desc)
+		}
 		if !*Help {
 			os.Exit(2)
 		}
 		return
 	}
 
-	b, err := parse()
+	if *JSON {
+		*Format = "json"
+	}
+	if *Format != "text" && *Format != "json" {
+		fmt.Fprintf(os.Stderr, "fatal: invalid format %q\n", *Format)
+		os.Exit(2)
+	}
+
+	topt := treeOptions{
+		ASCII:  *ASCII,
+		Depth:  *TreeDepth,
+		Date:   *Verbose,
+		Format: *TreeFmt,
+	}
+	if topt.Format != "text" && topt.Format != "json" {
+		fmt.Fprintf(os.Stderr, "fatal: invalid tree format %q\n", topt.Format)
+		os.Exit(2)
+	}
+	for _, c := range *TreeCols {
+		switch c {
+		case "id":
+			topt.ID = true
+		case "guid":
+			topt.GUID = true
+		case "date":
+			topt.Date = true
+		case "meta":
+			topt.Meta = true
+		default:
+			fmt.Fprintf(os.Stderr, "fatal: invalid tree column %q (expected %s)\n", c, strings.Join(treeColumns, ", "))
+			os.Exit(2)
+		}
+	}
+	if c, err := useColor(*Color, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(2)
+	} else {
+		topt.Color = c
+	}
+
+	// the tree and html export can share stdout (they could before the
+	// other options were added), but the json info can't
+	var stdout []string
+	if *Tree {
+		stdout = append(stdout, "--tree")
+	}
+	for _, fn := range *Export {
+		if fn == "-" {
+			stdout = append(stdout, "--export=-")
+		}
+	}
+	if *Format == "json" {
+		if len(stdout) != 0 {
+			fmt.Fprintf(os.Stderr, "fatal: --format=json can't be used with %s since both write to stdout\n", strings.Join(stdout, ", "))
+			os.Exit(2)
+		}
+		stdout = append(stdout, "--format=json")
+	}
+
+	b, valid, crlf, err := parse()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
 		os.Exit(1)
 	}
-
-	if !*Quiet {
-		info(os.Stderr, b)
+	if !valid {
+		if !*Fix {
+			fmt.Fprintf(os.Stderr, "fatal: parse bookmarks: invalid checksum %s (expected %s)\n", b.Checksum, b.CalculateChecksum())
+			os.Exit(1)
+		}
+		if pflag.Arg(0) == "-" && len(stdout) != 0 {
+			fmt.Fprintf(os.Stderr, "fatal: --fix-checksum can't be used with %s when reading from stdin since both write to stdout\n", strings.Join(stdout, ", "))
+			os.Exit(2)
+		}
+		b.UpdateChecksum()
+		if err := save(pflag.Arg(0), b, crlf); err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: fix checksum: %v\n", err)
+			os.Exit(1)
+		}
+		if !*Quiet {
+			fmt.Fprintf(os.Stderr, "Fixed checksum.\n")
+		}
 	}
 
+	info(b)
+
 	if *Tree {
-		tree(os.Stderr, b)
+		ns := []*crb.BookmarkNode{&b.Roots.BookmarkBar, &b.Roots.Other, &b.Roots.MobileBookmark}
+		if *TreeRoot != "" {
+			n, err := b.Lookup(*TreeRoot)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+				os.Exit(1)
+			}
+			ns = []*crb.BookmarkNode{n}
+		}
+		if err := tree(os.Stdout, topt, ns...); err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: write tree: %v\n", err)
+			os.Exit(1)
+		}
 	}
 
 	var fail bool
@@ -57,85 +188,216 @@ func main() {
 	}
 }
 
-func parse() (*crb.Bookmarks, error) {
-	var r io.Reader
-	switch input := pflag.Arg(0); input {
+func parse() (b *crb.Bookmarks, valid, crlf bool, err error) {
+	var unk []crb.UnknownField
+	if b, valid, crlf, unk, err = decode(pflag.Arg(0), *Lenient); err != nil {
+		return nil, false, false, err
+	}
+	if len(unk) != 0 && !*Quiet {
+		fmt.Fprintf(os.Stderr, "warning: found %d unknown fields\n", len(unk))
+		if *Verbose {
+			for _, f := range unk {
+				fmt.Fprintf(os.Stderr, "  %s\n", f)
+			}
+		}
+	}
+	return b, valid, crlf, nil
+}
+
+// decode reads the bookmarks file fn (- for stdin). If lenient is false, it is
+// an error for the file to contain unknown fields.
+func decode(fn string, lenient bool) (b *crb.Bookmarks, valid, crlf bool, unk []crb.UnknownField, err error) {
+	var buf []byte
+	switch fn {
 	case "-":
-		r = os.Stdin
+		buf, err = io.ReadAll(os.Stdin)
 	default:
-		if f, err := os.Open(input); err == nil {
-			defer f.Close()
-			r = f
-		} else {
-			return nil, err
-		}
+		buf, err = os.ReadFile(fn)
+	}
+	if err != nil {
+		return nil, false, false, nil, err
+	}
+	crlf = bytes.Contains(buf, []byte("\r\n"))
+
+	if lenient {
+		b, valid, unk, err = crb.DecodeLenient(bytes.NewReader(buf))
+	} else {
+		b, valid, err = crb.Decode(bytes.NewReader(buf))
+	}
+	if err != nil {
+		return nil, false, false, nil, fmt.Errorf("parse bookmarks: %w", err)
+	}
+	return b, valid, crlf, unk, nil
+}
+
+// save atomically replaces the bookmarks file fn (- for stdout) with b.
+func save(fn string, b *crb.Bookmarks, crlf bool) error {
+	opt := crb.EncodeOptions{
+		CRLF:           crlf,
+		UpdateChecksum: true,
+	}
+	if fn == "-" {
+		return opt.Encode(os.Stdout, b)
 	}
 
-	b, valid, err := crb.Decode(r)
+	mode := os.FileMode(0666)
+	if fi, err := os.Stat(fn); err == nil {
+		mode = fi.Mode().Perm()
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(fn), "."+filepath.Base(fn)+".*")
 	if err != nil {
-		return nil, fmt.Errorf("parse bookmarks: %w", err)
+		return err
 	}
-	if !valid {
-		return nil, fmt.Errorf("parse bookmarks: invalid checksum")
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := opt.Encode(f, b); err != nil {
+		return err
 	}
-	return b, nil
+	if err := f.Chmod(mode); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), fn)
 }
 
-func info(w io.Writer, b *crb.Bookmarks) {
-	var t crb.Time
-	var cf, cb int
-	b.Walk(func(n crb.BookmarkNode, parents ...string) error {
-		switch n.Type {
-		case crb.NodeTypeFolder:
-			cf++
-		case crb.NodeTypeURL:
-			cb++
-		}
-		if v := n.DateAdded; v > t {
-			t = v
-		}
-		if v := n.DateLastUsed; v > t {
-			t = v
-		}
-		if v := n.DateModified; v > t {
-			t = v
-		}
-		return nil
-	})
-	fmt.Fprintf(w, "Version: %d\n", b.Version)
-	fmt.Fprintf(w, "Folders: %d\n", cf)
-	fmt.Fprintf(w, "Bookmarks: %d\n", cb)
-	fmt.Fprintf(w, "Modified: %s\n", t.Time().Format(time.ANSIC))
-	fmt.Fprintf(w, "Checksum: %s\n", b.Checksum)
-	fmt.Fprintf(w, "Bookmarks bar GUID: %s\n", b.Roots.BookmarkBar.GUID.String())
+// infoCount is the number of nodes in a tree.
+type infoCount struct {
+	Folder int `json:"folders"`
+	URL    int `json:"urls"`
 }
 
-func tree(w io.Writer, b *crb.Bookmarks) {
-	fmt.Fprintf(w, "\n")
-	b.Walk(func(n crb.BookmarkNode, parents ...string) error {
-		for range parents {
-			fmt.Fprintf(w, "  ")
-		}
-		if n.Type == crb.NodeTypeFolder {
-			if *Verbose && !n.DateAdded.IsZero() {
-				fmt.Fprintf(w, "\x1b[1m+ %s \x1b[90m[%s -> %s]\x1b[0m\n", n.Name, n.DateAdded.Time().Format("Jan 02 2006"), n.DateModified.Time().Format("Jan 02 2006"))
-			} else {
-				fmt.Fprintf(w, "\x1b[1m+ %s\x1b[0m\n", n.Name)
+// infoRoot is a permanent folder.
+type infoRoot struct {
+	GUID  string    `json:"guid"`
+	Name  string    `json:"name"`
+	Count infoCount `json:"count"`
+}
+
+// infoDate is a date in the formats used by crb-carve. It is null if there
+// aren't any dates.
+type infoDate struct {
+	Unix      int64  `json:"unix"`
+	UnixMicro int64  `json:"unixmicro"`
+	YYYYMMDD  string `json:"yyyymmdd"`
+}
+
+// infoRecord is the info about a bookmarks file. The fields present in the
+// crb-carve --json records have the same names and meanings.
+type infoRecord struct {
+	Input struct {
+		Path     string `json:"path"`
+		Basename string `json:"basename"`
+	} `json:"input"`
+	Bookmarks struct {
+		Version       int                 `json:"version"`
+		BarGUID       string              `json:"barguid"`
+		Checksum      string              `json:"checksum"`
+		ChecksumValid bool                `json:"checksum_valid"`
+		Date          *infoDate           `json:"date"`     // most recent
+		DateMin       *infoDate           `json:"date_min"` // oldest
+		Count         infoCount           `json:"count"`
+		Roots         map[string]infoRoot `json:"roots"`
+		SyncMetadata  bool                `json:"sync_metadata"` // present
+		MetaInfo      bool                `json:"meta_info"`     // present
+	} `json:"bookmarks"`
+}
+
+// info writes info about the bookmarks file in the selected format.
+func info(b *crb.Bookmarks) {
+	var m infoRecord
+	m.Input.Path = pflag.Arg(0)
+	m.Input.Basename = filepath.Base(pflag.Arg(0))
+	m.Bookmarks.Version = int(b.Version)
+	m.Bookmarks.BarGUID = b.Roots.BookmarkBar.GUID.String()
+	m.Bookmarks.Checksum = b.Checksum
+	m.Bookmarks.ChecksumValid = b.Checksum == b.CalculateChecksum()
+	m.Bookmarks.SyncMetadata = len(b.SyncMetadata) != 0
+	m.Bookmarks.MetaInfo = len(b.MetaInfo) != 0
+
+	var tmin, tmax crb.Time
+	m.Bookmarks.Roots = map[string]infoRoot{}
+	for _, t := range []crb.RootType{crb.RootBookmarkBar, crb.RootOther, crb.RootMobile} {
+		r := b.Root(t)
+		var c infoCount
+		for _, n := range r.Descendants() {
+			switch n.Type {
+			case crb.NodeTypeFolder:
+				c.Folder++
+			case crb.NodeTypeURL:
+				c.URL++
 			}
-		} else {
-			if *Verbose && !n.DateAdded.IsZero() {
-				fmt.Fprintf(w, "\x1b[1m-\x1b[0m %s \x1b[90m[%s]\x1b[0m\n", n.Name, n.DateAdded.Time().Format("Jan 02 2006"))
-			} else {
-				fmt.Fprintf(w, "\x1b[1m-\x1b[0m %s\n", n.Name)
+		}
+		r.Walk(func(n crb.BookmarkNode, parents ...string) error {
+			for _, v := range []crb.Time{n.DateAdded, n.DateLastUsed, n.DateModified} {
+				if v > tmax {
+					tmax = v
+				}
+				if !v.IsZero() && (tmin.IsZero() || v < tmin) {
+					tmin = v
+				}
 			}
-			for range parents {
-				fmt.Fprintf(w, "  ")
+			return nil
+		})
+		m.Bookmarks.Count.Folder += c.Folder + 1
+		m.Bookmarks.Count.URL += c.URL
+		m.Bookmarks.Roots[string(t)] = infoRoot{r.GUID.String(), r.Name, c}
+	}
+	for _, x := range []struct {
+		D **infoDate
+		T crb.Time
+	}{
+		{&m.Bookmarks.Date, tmax},
+		{&m.Bookmarks.DateMin, tmin},
+	} {
+		if !x.T.IsZero() {
+			*x.D = &infoDate{
+				Unix:      x.T.Unix(),
+				UnixMicro: x.T.UnixMicro(),
+				YYYYMMDD:  x.T.Time().Format("20060102"),
 			}
-			fmt.Fprintf(w, "\x1b[90m  %s\x1b[0m\n", n.URL)
 		}
-		return nil
-	})
-	fmt.Fprintf(w, "\n")
+	}
+
+	if *Format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.Encode(m)
+		return
+	}
+	if *Quiet {
+		return
+	}
+	w := os.Stderr
+	fmt.Fprintf(w, "Version: %d\n", b.Version)
+	fmt.Fprintf(w, "Folders: %d\n", m.Bookmarks.Count.Folder)
+	fmt.Fprintf(w, "Bookmarks: %d\n", m.Bookmarks.Count.URL)
+	fmt.Fprintf(w, "Modified: %s\n", infoTime(tmax))
+	fmt.Fprintf(w, "Checksum: %s\n", b.Checksum)
+	fmt.Fprintf(w, "Bookmarks bar GUID: %s\n", m.Bookmarks.BarGUID)
+	if *Verbose {
+		fmt.Fprintf(w, "Created: %s\n", infoTime(tmin))
+		for _, t := range []crb.RootType{crb.RootBookmarkBar, crb.RootOther, crb.RootMobile} {
+			r := m.Bookmarks.Roots[string(t)]
+			fmt.Fprintf(w, "Root %s: %q %s (%d folders, %d bookmarks)\n", t, r.Name, r.GUID, r.Count.Folder, r.Count.URL)
+		}
+		fmt.Fprintf(w, "Sync metadata: %t\n", m.Bookmarks.SyncMetadata)
+		fmt.Fprintf(w, "Meta info: %t\n", m.Bookmarks.MetaInfo)
+	}
+}
+
+// infoTime formats t for the text output.
+func infoTime(t crb.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+	return t.Time().Format(time.ANSIC)
 }
 
 func export(fn string, b *crb.Bookmarks) (rerr error) {
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pgaskin/crb"
+	"github.com/spf13/pflag"
+)
+
+func merge(args []string) {
+	fs := pflag.NewFlagSet("merge", pflag.ExitOnError)
+	output := fs.StringP("output", "o", "", "write the merged bookmarks to the specified file instead of ours (- for stdout)")
+	quiet := fs.BoolP("quiet", "q", false, "don't write conflicts to stderr")
+	help := fs.BoolP("help", "h", false, "show this help text")
+	fs.Parse(args)
+
+	if fs.NArg() != 3 || *help {
+		fmt.Printf("Usage: %s merge [options] base_file ours_file theirs_file\n\nOptions:\n%s", os.Args[0], fs.FlagUsages())
+		fmt.Printf("\nMerges the changes from base to theirs into ours, matching nodes by GUID. If\n")
+		fmt.Printf("both sides made conflicting changes, ours is kept, the conflicts are written to\n")
+		fmt.Printf("stderr, and the exit status is 1. To use it as a git merge driver:\n\n")
+		fmt.Printf("  git config merge.crb.driver '%s merge %%O %%A %%B'\n", os.Args[0])
+		fmt.Printf("  echo 'Bookmarks merge=crb' >> .gitattributes\n")
+		if !*help {
+			os.Exit(2)
+		}
+		return
+	}
+
+	var bs [3]*crb.Bookmarks
+	var crlf bool
+	for i, fn := range fs.Args() {
+		b, _, c, _, err := decode(fn, true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: %s: %v\n", fn, err)
+			os.Exit(2)
+		}
+		if i == 1 {
+			crlf = c
+		}
+		bs[i] = b
+	}
+
+	m, cs := crb.Merge(bs[0], bs[1], bs[2])
+
+	fn := *output
+	if fn == "" {
+		fn = fs.Arg(1)
+	}
+	if err := save(fn, m, crlf); err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: write merged bookmarks: %v\n", err)
+		os.Exit(2)
+	}
+
+	if len(cs) != 0 {
+		if !*quiet {
+			for _, c := range cs {
+				fmt.Fprintf(os.Stderr, "conflict: %s\n", c)
+			}
+		}
+		os.Exit(1)
+	}
+}
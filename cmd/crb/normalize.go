@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pgaskin/crb"
+	"github.com/pgaskin/crb/urlnorm"
+	"github.com/spf13/pflag"
+)
+
+func normalize(args []string) {
+	fs := pflag.NewFlagSet("normalize", pflag.ExitOnError)
+	rules := fs.StringP("rules", "r", "default", "comma-separated normalization rules (prefix with - to exclude)")
+	dryRun := fs.BoolP("dry-run", "n", false, "only report the changes")
+	output := fs.StringP("output", "o", "", "write the normalized bookmarks to the specified file (- for stdout) instead of rewriting it")
+	quiet := fs.BoolP("quiet", "q", false, "don't report the changes")
+	help := fs.BoolP("help", "h", false, "show this help text")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || *help {
+		fmt.Printf("Usage: %s normalize [options] bookmarks_file\n\nOptions:\n%s", os.Args[0], fs.FlagUsages())
+		fmt.Printf("\nRules:\n")
+		fmt.Printf("  scheme           lowercase the scheme\n")
+		fmt.Printf("  host             lowercase the host\n")
+		fmt.Printf("  port             remove default ports\n")
+		fmt.Printf("  empty-path       add a slash if the path is empty\n")
+		fmt.Printf("  trailing-slash   remove the trailing slash from non-root paths\n")
+		fmt.Printf("  sort-query       sort the query parameters by name\n")
+		fmt.Printf("  tracking         remove tracking query parameters (utm_*, fbclid, gclid, etc)\n")
+		fmt.Printf("  fragment         remove the fragment\n")
+		fmt.Printf("  default          %s\n", urlnorm.Default)
+		fmt.Printf("  all              all of the above\n")
+		if !*help {
+			os.Exit(2)
+		}
+		return
+	}
+
+	r, err := urlnorm.ParseRules(*rules)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: invalid --rules value: %v\n", err)
+		os.Exit(2)
+	}
+
+	b, _, crlf, _, err := decode(fs.Arg(0), true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(1)
+	}
+
+	var n int
+	for p, x := range b.URLs() {
+		if u := r.Normalize(x.URL); u != x.URL {
+			if !*quiet {
+				fmt.Printf("%s\n  - %s\n  + %s\n", crb.JoinPath(p...), x.URL, u)
+			}
+			if err := b.SetURL(x, u); err != nil {
+				fmt.Fprintf(os.Stderr, "fatal: %v\n", err) // shouldn't happen since Normalize returns the original url if it's invalid
+				os.Exit(1)
+			}
+			n++
+		}
+	}
+
+	if !*dryRun && n != 0 {
+		fn := *output
+		if fn == "" {
+			fn = fs.Arg(0)
+		}
+		if err := save(fn, b, crlf); err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: write bookmarks: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if !*quiet {
+		fmt.Fprintf(os.Stderr, "Normalized %d urls.\n", n)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pgaskin/crb"
+	"github.com/pgaskin/crb/query"
+	"github.com/pgaskin/crb/urlnorm"
+	"github.com/spf13/pflag"
+)
+
+func search(args []string) {
+	fs := pflag.NewFlagSet("search", pflag.ExitOnError)
+	format := fs.StringP("format", "f", "flat", "output format (flat, tree, json, urls)")
+	normalize := fs.StringP("normalize", "n", "", "normalize bookmark urls before matching and output (see crb normalize --help)")
+	help := fs.BoolP("help", "h", false, "show this help text")
+	fs.Parse(args)
+
+	switch *format {
+	case "flat", "tree", "json", "urls":
+	default:
+		fmt.Fprintf(os.Stderr, "fatal: invalid format %q\n", *format)
+		os.Exit(2)
+	}
+
+	if fs.NArg() < 1 || *help {
+		fmt.Printf("Usage: %s search [options] bookmarks_file query...\n\nOptions:\n%s", os.Args[0], fs.FlagUsages())
+		fmt.Printf("\nQueries are terms matching the name or url, or field:value, combined with\n")
+		fmt.Printf("AND (implicit), OR, NOT (or a - prefix), and parentheses. Fields:\n\n")
+		fmt.Printf("  name:foo  name:/re/  name~\"re\"  url:foo  url:/re/  url~\"re\"  host:example.com\n")
+		fmt.Printf("  host:*.example.com  path:/foo  path:/foo/*  in:Work  in:\"Bookmarks bar/Work/*\"\n")
+		fmt.Printf("  type:url  type:folder  added:2021  added:>=2021-05  added:2020..2021-06-15\n")
+		fmt.Printf("  modified:...  used:...  meta:key  meta:key=value\n")
+		fmt.Printf("\nExample: %s search Bookmarks 'in:Work added:2021 host:*.atlassian.net'\n", os.Args[0])
+		if !*help {
+			os.Exit(2)
+		}
+		return
+	}
+
+	q, err := query.Parse(strings.Join(fs.Args()[1:], " "))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: parse query: %v\n", err)
+		os.Exit(2)
+	}
+
+	var rules urlnorm.Rules
+	if *normalize != "" {
+		if rules, err = urlnorm.ParseRules(*normalize); err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: invalid --normalize value: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	b, _, _, _, err := decode(fs.Arg(0), true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(1)
+	}
+	if rules != 0 {
+		for _, n := range b.URLs() {
+			n.URL = rules.Normalize(n.URL)
+		}
+	}
+
+	ns := query.Find(b, q)
+	switch *format {
+	case "flat":
+		for _, n := range ns {
+			if n.Type == crb.NodeTypeFolder {
+				fmt.Printf("%s/\n", crb.JoinPath(n.Path...))
+			} else {
+				fmt.Printf("%s\t%s\n", crb.JoinPath(n.Path...), n.URL)
+			}
+		}
+	case "tree":
+		var last []string
+		for _, n := range ns {
+			var i int // common ancestors with the previous match
+			for i < len(last) && i < len(n.Path)-1 && last[i] == n.Path[i] {
+				i++
+			}
+			for ; i < len(n.Path); i++ {
+				fmt.Print(strings.Repeat("  ", i))
+				if i == len(n.Path)-1 && n.Type != crb.NodeTypeFolder {
+					fmt.Printf("- %s\n%s  %s\n", n.Name, strings.Repeat("  ", i), n.URL)
+				} else {
+					fmt.Printf("+ %s\n", n.Path[i])
+				}
+			}
+			last = n.Path
+		}
+	case "json":
+		type result struct {
+			Path         []string     `json:"path"`
+			ID           int          `json:"id"`
+			GUID         crb.GUID     `json:"guid"`
+			Type         crb.NodeType `json:"type"`
+			Name         string       `json:"name"`
+			URL          string       `json:"url,omitempty"`
+			DateAdded    crb.Time     `json:"date_added"`
+			DateModified crb.Time     `json:"date_modified,omitempty"`
+			DateLastUsed crb.Time     `json:"date_last_used,omitempty"`
+		}
+		rs := []result{}
+		for _, n := range ns {
+			rs = append(rs, result{n.Path, n.ID, n.GUID, n.Type, n.Name, n.URL, n.DateAdded, n.DateModified, n.DateLastUsed})
+		}
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		if err := e.Encode(rs); err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+			os.Exit(1)
+		}
+	case "urls":
+		for _, n := range ns {
+			if n.Type == crb.NodeTypeURL {
+				fmt.Println(n.URL)
+			}
+		}
+	}
+
+	if len(ns) == 0 {
+		os.Exit(1)
+	}
+}
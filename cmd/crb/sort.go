@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pgaskin/crb"
+	"github.com/spf13/pflag"
+)
+
+func sortBookmarks(args []string) {
+	fs := pflag.NewFlagSet("sort", pflag.ExitOnError)
+	by := fs.StringP("by", "b", "name", "what to sort by (name, url, host, added, used)")
+	reverse := fs.BoolP("reverse", "r", false, "reverse the order")
+	foldersFirst := fs.BoolP("folders-first", "f", false, "put folders before bookmarks")
+	recursive := fs.BoolP("recursive", "R", false, "also sort the contents of subfolders")
+	pin := fs.StringArrayP("pin", "p", nil, "keep children with names matching the pattern at the start of their folder")
+	locale := fs.StringP("locale", "L", "", "sort names using the collation rules for the BCP 47 language tag (e.g., sv, de-u-co-phonebk)")
+	output := fs.StringP("output", "o", "", "write the sorted bookmarks to the specified file (- for stdout) instead of rewriting it")
+	help := fs.BoolP("help", "h", false, "show this help text")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 || *help {
+		fmt.Printf("Usage: %s sort [options] bookmarks_file [folder_path...]\n\nOptions:\n%s", os.Args[0], fs.FlagUsages())
+		fmt.Printf("\nIf no folders are specified, the permanent folders are sorted. Names are sorted\n")
+		fmt.Printf("using Unicode collation in natural order (e.g., 2 before 10) ignoring case and\n")
+		fmt.Printf("accents, urls and hosts are sorted after folders, and dates are sorted oldest\n")
+		fmt.Printf("first.\n")
+		if !*help {
+			os.Exit(2)
+		}
+		return
+	}
+
+	opt := crb.SortOptions{
+		By:           crb.SortKey(*by),
+		Reverse:      *reverse,
+		FoldersFirst: *foldersFirst,
+		Recursive:    *recursive,
+		Pinned:       *pin,
+		Locale:       *locale,
+	}
+
+	b, _, crlf, _, err := decode(fs.Arg(0), true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(1)
+	}
+
+	paths := fs.Args()[1:]
+	if len(paths) == 0 {
+		paths = []string{string(crb.RootBookmarkBar), string(crb.RootOther), string(crb.RootMobile)}
+	}
+	for _, p := range paths {
+		// note: look it up each time since sorting invalidates pointers
+		n, err := b.Lookup(p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+			os.Exit(1)
+		}
+		if n.Type != crb.NodeTypeFolder {
+			fmt.Fprintf(os.Stderr, "fatal: %q is not a folder\n", p)
+			os.Exit(1)
+		}
+		if err := n.Sort(opt); err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	fn := *output
+	if fn == "" {
+		fn = fs.Arg(0)
+	}
+	if err := save(fn, b, crlf); err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: write bookmarks: %v\n", err)
+		os.Exit(1)
+	}
+}
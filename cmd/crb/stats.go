@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pgaskin/crb"
+	"github.com/spf13/pflag"
+	"golang.org/x/net/publicsuffix"
+)
+
+func stats(args []string) {
+	fs := pflag.NewFlagSet("stats", pflag.ExitOnError)
+	jsn := fs.BoolP("json", "j", false, "write the statistics as json")
+	top := fs.IntP("top", "n", 10, "number of hosts, domains, and folders to show (0 for all)")
+	help := fs.BoolP("help", "h", false, "show this help text")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || *help {
+		fmt.Printf("Usage: %s stats [options] bookmarks_file\n\nOptions:\n%s", os.Args[0], fs.FlagUsages())
+		fmt.Printf("\nRegistrable domains are found using the public suffix list (e.g.,\n")
+		fmt.Printf("a.b.example.co.uk is example.co.uk). Duplicates are found like crb dedupe.\n")
+		if !*help {
+			os.Exit(2)
+		}
+		return
+	}
+
+	b, _, _, _, err := decode(fs.Arg(0), true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(1)
+	}
+
+	type count struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+	type folder struct {
+		Path     string `json:"path"`
+		Children int    `json:"children"`
+		URLs     int    `json:"urls"` // recursive
+	}
+	var s struct {
+		Count struct {
+			Folders      int `json:"folders"`
+			URLs         int `json:"urls"`
+			EmptyFolders int `json:"empty_folders"` // without any bookmarks, recursively
+		} `json:"count"`
+		Hosts          []count  `json:"hosts"`
+		Domains        []count  `json:"domains"`
+		Schemes        []count  `json:"schemes"`
+		Depth          []count  `json:"depth"`
+		LargestFolders []folder `json:"largest_folders"`
+		Added          struct {
+			Years  []count `json:"years"`
+			Months []count `json:"months"`
+		} `json:"added"`
+		Staleness  []count `json:"staleness"`
+		Duplicates struct {
+			Groups int `json:"groups"` // urls with duplicates
+			URLs   int `json:"urls"`   // bookmarks which would be removed
+		} `json:"duplicates"`
+	}
+
+	hosts, domains, schemes, depth := map[string]int{}, map[string]int{}, map[string]int{}, map[string]int{}
+	years, months, stale := map[string]int{}, map[string]int{}, map[string]int{}
+	var folders []folder
+
+	now := time.Now()
+	staleness := []struct {
+		Name string
+		Age  time.Duration
+	}{
+		{"< 1 month", 30 * 24 * time.Hour},
+		{"< 3 months", 91 * 24 * time.Hour},
+		{"< 1 year", 365 * 24 * time.Hour},
+		{"< 2 years", 2 * 365 * 24 * time.Hour},
+		{">= 2 years", 1<<63 - 1},
+	}
+
+	for p, n := range b.All() {
+		switch n.Type {
+		case crb.NodeTypeFolder:
+			s.Count.Folders++
+			if len(p) == 1 {
+				break // permanent folder
+			}
+			f := folder{Path: crb.JoinPath(p...)}
+			if n.Children != nil {
+				f.Children = len(*n.Children)
+			}
+			for _, c := range n.Descendants() {
+				if c.Type == crb.NodeTypeURL {
+					f.URLs++
+				}
+			}
+			if f.URLs == 0 {
+				s.Count.EmptyFolders++ // like crb dedupe, folders only containing empty folders are empty too
+			}
+			folders = append(folders, f)
+		case crb.NodeTypeURL:
+			s.Count.URLs++
+			depth[strconv.Itoa(len(p)-1)]++
+			if u, err := url.Parse(n.URL); err == nil {
+				schemes[strings.ToLower(u.Scheme)]++
+				if h := strings.ToLower(u.Hostname()); h != "" {
+					hosts[h]++
+					domains[registrableDomain(h)]++
+				}
+			}
+			if !n.DateAdded.IsZero() {
+				t := n.DateAdded.Time()
+				years[t.Format("2006")]++
+				months[t.Format("2006-01")]++
+			}
+			if n.DateLastUsed.IsZero() {
+				stale["never"]++
+			} else {
+				age := now.Sub(n.DateLastUsed.Time())
+				for _, x := range staleness {
+					if age < x.Age {
+						stale[x.Name]++
+						break
+					}
+				}
+			}
+		}
+	}
+
+	// sorted by count, then name
+	byCount := func(m map[string]int, n int) []count {
+		cs := []count{}
+		for k, v := range m {
+			cs = append(cs, count{k, v})
+		}
+		sort.Slice(cs, func(i, j int) bool {
+			if cs[i].Count != cs[j].Count {
+				return cs[i].Count > cs[j].Count
+			}
+			return cs[i].Name < cs[j].Name
+		})
+		if n > 0 && len(cs) > n {
+			cs = cs[:n]
+		}
+		return cs
+	}
+
+	// sorted by name (numerically if possible)
+	byName := func(m map[string]int) []count {
+		cs := []count{}
+		for k, v := range m {
+			cs = append(cs, count{k, v})
+		}
+		sort.Slice(cs, func(i, j int) bool {
+			a, errA := strconv.Atoi(cs[i].Name)
+			b, errB := strconv.Atoi(cs[j].Name)
+			if errA == nil && errB == nil {
+				return a < b
+			}
+			return cs[i].Name < cs[j].Name
+		})
+		return cs
+	}
+
+	s.Hosts = byCount(hosts, *top)
+	s.Domains = byCount(domains, *top)
+	s.Schemes = byCount(schemes, 0)
+	s.Depth = byName(depth)
+	s.Added.Years = byName(years)
+	s.Added.Months = byName(months)
+
+	s.Staleness = []count{}
+	if v := stale["never"]; v != 0 {
+		s.Staleness = append(s.Staleness, count{"never", v})
+	}
+	for _, x := range staleness {
+		if v := stale[x.Name]; v != 0 {
+			s.Staleness = append(s.Staleness, count{x.Name, v})
+		}
+	}
+
+	sort.SliceStable(folders, func(i, j int) bool {
+		return folders[i].Children > folders[j].Children
+	})
+	if *top > 0 && len(folders) > *top {
+		folders = folders[:*top]
+	}
+	s.LargestFolders = append([]folder{}, folders...)
+
+	for _, g := range (crb.DedupeOptions{}).Find(b).URLs {
+		s.Duplicates.Groups++
+		s.Duplicates.URLs += len(g.Nodes) - 1
+	}
+
+	if *jsn {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(s); err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	defer tw.Flush()
+
+	section := func(title string, cs []count) {
+		fmt.Fprintf(tw, "\n%s:\n", title)
+		for _, c := range cs {
+			fmt.Fprintf(tw, "%d\t  %s\n", c.Count, c.Name)
+		}
+	}
+	fmt.Fprintf(tw, "Folders: %d (%d empty)\n", s.Count.Folders, s.Count.EmptyFolders)
+	fmt.Fprintf(tw, "Bookmarks: %d\n", s.Count.URLs)
+	fmt.Fprintf(tw, "Duplicate URLs: %d (%d redundant bookmarks)\n", s.Duplicates.Groups, s.Duplicates.URLs)
+	section("Top hosts", s.Hosts)
+	section("Top domains", s.Domains)
+	section("Schemes", s.Schemes)
+	section("Bookmarks by depth", s.Depth)
+	fmt.Fprintf(tw, "\nLargest folders:\n")
+	for _, f := range s.LargestFolders {
+		fmt.Fprintf(tw, "%d\t  %s (%d bookmarks)\n", f.Children, f.Path, f.URLs)
+	}
+	section("Added per year", s.Added.Years)
+	section("Added per month", s.Added.Months)
+	section("Last used", s.Staleness)
+}
+
+// registrableDomain returns the registrable domain (eTLD+1) of a host, or the
+// host itself if it doesn't have one (e.g., an IP address or a public suffix).
+func registrableDomain(h string) string {
+	if net.ParseIP(strings.Trim(h, "[]")) != nil {
+		return h
+	}
+	d, err := publicsuffix.EffectiveTLDPlusOne(strings.TrimSuffix(h, "."))
+	if err != nil {
+		return h
+	}
+	return d
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestRegistrableDomain(t *testing.T) {
+	for _, tc := range []struct {
+		host, domain string
+	}{
+		{"www.example.com", "example.com"},
+		{"example.com", "example.com"},
+		{"a.b.example.co.uk", "example.co.uk"},
+		{"user.github.io", "user.github.io"},
+		{"foo.bar.s3.amazonaws.com", "bar.s3.amazonaws.com"},
+		{"www.example.com.", "example.com"},
+		{"co.uk", "co.uk"},
+		{"localhost", "localhost"},
+		{"192.168.0.1", "192.168.0.1"},
+		{"[::1]", "[::1]"},
+	} {
+		if act := registrableDomain(tc.host); act != tc.domain {
+			t.Errorf("%q: got %q, expected %q", tc.host, act, tc.domain)
+		}
+	}
+}
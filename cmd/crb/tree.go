@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pgaskin/crb"
+)
+
+// treeOptions controls how a bookmarks tree is rendered.
+type treeOptions struct {
+	Color  bool
+	ASCII  bool
+	Depth  int // 0 for unlimited
+	ID     bool
+	GUID   bool
+	Date   bool
+	Meta   bool
+	Format string // text or json
+}
+
+// treeColumns are the valid values for --tree-columns.
+var treeColumns = []string{"id", "guid", "date", "meta"}
+
+// useColor determines whether to use colors for the specified --color value
+// when writing to f.
+func useColor(when string, f *os.File) (bool, error) {
+	switch when {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+			return false, nil
+		}
+		fi, err := f.Stat()
+		return err == nil && fi.Mode()&os.ModeCharDevice != 0, nil
+	default:
+		return false, fmt.Errorf("invalid color mode %q (expected auto, always, or never)", when)
+	}
+}
+
+// treeNode is a node in the json tree.
+type treeNode struct {
+	ID           int               `json:"id"`
+	GUID         crb.GUID          `json:"guid"`
+	Type         crb.NodeType      `json:"type"`
+	Name         string            `json:"name"`
+	URL          string            `json:"url,omitempty"`
+	DateAdded    crb.Time          `json:"date_added"`
+	DateModified crb.Time          `json:"date_modified,omitempty"`
+	DateLastUsed crb.Time          `json:"date_last_used,omitempty"`
+	MetaInfo     map[string]string `json:"meta_info,omitempty"`
+	Children     []treeNode        `json:"children,omitempty"`
+	Truncated    bool              `json:"truncated,omitempty"` // children omitted due to the depth limit
+}
+
+// tree writes the trees rooted at ns.
+func tree(w io.Writer, o treeOptions, ns ...*crb.BookmarkNode) error {
+	if o.Format == "json" {
+		js := []treeNode{}
+		for _, n := range ns {
+			js = append(js, treeJSON(n, o.Depth))
+		}
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(js)
+	}
+	for _, n := range ns {
+		treeText(w, o, n, "", "", 0)
+	}
+	return nil
+}
+
+func treeJSON(n *crb.BookmarkNode, depth int) treeNode {
+	j := treeNode{
+		ID:           n.ID,
+		GUID:         n.GUID,
+		Type:         n.Type,
+		Name:         n.Name,
+		URL:          n.URL,
+		DateAdded:    n.DateAdded,
+		DateModified: n.DateModified,
+		DateLastUsed: n.DateLastUsed,
+		MetaInfo:     n.MetaInfo,
+	}
+	if n.Children != nil && len(*n.Children) != 0 {
+		if depth == 1 {
+			j.Truncated = true
+		} else {
+			j.Children = []treeNode{}
+			for i := range *n.Children {
+				j.Children = append(j.Children, treeJSON(&(*n.Children)[i], depth-1))
+			}
+		}
+	}
+	return j
+}
+
+// treeText writes n with the prefix for its own line (head) and the prefix for
+// the lines below it (body).
+func treeText(w io.Writer, o treeOptions, n *crb.BookmarkNode, head, body string, depth int) {
+	const (
+		bold  = "\x1b[1m"
+		dim   = "\x1b[90m"
+		reset = "\x1b[0m"
+	)
+	style := func(s, c string) string {
+		if !o.Color || s == "" {
+			return s
+		}
+		return c + s + reset
+	}
+
+	var cols []string
+	if o.ID {
+		cols = append(cols, fmt.Sprintf("#%d", n.ID))
+	}
+	if o.GUID {
+		cols = append(cols, string(n.GUID))
+	}
+	if o.Date && !n.DateAdded.IsZero() {
+		if n.Type == crb.NodeTypeFolder && !n.DateModified.IsZero() {
+			cols = append(cols, n.DateAdded.Time().Format("Jan 02 2006")+" -> "+n.DateModified.Time().Format("Jan 02 2006"))
+		} else {
+			cols = append(cols, n.DateAdded.Time().Format("Jan 02 2006"))
+		}
+	}
+	if o.Meta && len(n.MetaInfo) != 0 {
+		ks := make([]string, 0, len(n.MetaInfo))
+		for k := range n.MetaInfo {
+			ks = append(ks, k)
+		}
+		sort.Strings(ks)
+		for i, k := range ks {
+			ks[i] = k + "=" + n.MetaInfo[k]
+		}
+		cols = append(cols, "{"+strings.Join(ks, ", ")+"}")
+	}
+	var extra string
+	if len(cols) != 0 {
+		extra = " " + style("["+strings.Join(cols, "] [")+"]", dim)
+	}
+
+	var cs []crb.BookmarkNode
+	if n.Children != nil {
+		cs = *n.Children
+	}
+	if n.Type == crb.NodeTypeFolder {
+		more := ""
+		if len(cs) != 0 && depth+1 == o.Depth {
+			more = style(fmt.Sprintf(" (%d more)", len(cs)), dim)
+			cs = nil
+		}
+		fmt.Fprintf(w, "%s%s%s%s\n", head, style(n.Name, bold), extra, more)
+	} else {
+		fmt.Fprintf(w, "%s%s%s\n", head, n.Name, extra)
+		fmt.Fprintf(w, "%s%s\n", body, style(n.URL, dim))
+	}
+
+	branch, last, pipe := "├── ", "└── ", "│   "
+	if o.ASCII {
+		branch, last, pipe = "|-- ", "`-- ", "|   "
+	}
+	for i := range cs {
+		if i == len(cs)-1 {
+			treeText(w, o, &cs[i], body+last, body+"    ", depth+1)
+		} else {
+			treeText(w, o, &cs[i], body+branch, body+pipe, depth+1)
+		}
+	}
+}
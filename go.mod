@@ -1,5 +1,9 @@
 module github.com/pgaskin/crb
 
-go 1.18
+go 1.23.0
 
-require github.com/spf13/pflag v1.0.5
+require (
+	github.com/spf13/pflag v1.0.5
+	golang.org/x/net v0.43.0
+	golang.org/x/text v0.28.0
+)
@@ -0,0 +1,148 @@
+package crb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// writeJSON writes v (as decoded by encoding/json with UseNumber) in the same
+// format as base::JSONWriter with OPTIONS_PRETTY_PRINT.
+//
+// See:
+//   - https://source.chromium.org/chromium/chromium/src/+/main:base/json/json_writer.cc;drc=aabc28688acc0ba19b42ac3795febddc11a43ede
+//   - https://source.chromium.org/chromium/chromium/src/+/main:base/json/string_escape.cc;drc=aabc28688acc0ba19b42ac3795febddc11a43ede
+func writeJSON(w io.Writer, v interface{}, crlf bool) error {
+	jw := jsonWriter{
+		w:  bufio.NewWriter(w),
+		nl: "\n",
+	}
+	if crlf {
+		jw.nl = "\r\n"
+	}
+	if err := jw.value(v, 0); err != nil {
+		return err
+	}
+	jw.w.WriteString(jw.nl)
+	return jw.w.Flush()
+}
+
+type jsonWriter struct {
+	w  *bufio.Writer
+	nl string
+}
+
+func (jw jsonWriter) value(v interface{}, depth int) error {
+	switch v := v.(type) {
+	case nil:
+		jw.w.WriteString("null")
+	case bool:
+		if v {
+			jw.w.WriteString("true")
+		} else {
+			jw.w.WriteString("false")
+		}
+	case json.Number:
+		jw.w.WriteString(v.String())
+	case string:
+		jw.string(v)
+	case []interface{}:
+		jw.w.WriteString("[ ")
+		for i, x := range v {
+			if i != 0 {
+				jw.w.WriteString(", ")
+			}
+			if err := jw.value(x, depth); err != nil {
+				return err
+			}
+		}
+		jw.w.WriteString(" ]")
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		jw.w.WriteString("{")
+		jw.w.WriteString(jw.nl)
+		for i, k := range keys {
+			if i != 0 {
+				jw.w.WriteString(",")
+				jw.w.WriteString(jw.nl)
+			}
+			jw.indent(depth + 1)
+			jw.string(k)
+			jw.w.WriteString(": ")
+			if err := jw.value(v[k], depth+1); err != nil {
+				return err
+			}
+		}
+		if len(keys) != 0 {
+			jw.w.WriteString(jw.nl)
+		}
+		jw.indent(depth)
+		jw.w.WriteString("}")
+	default:
+		return fmt.Errorf("unsupported json value type %T", v)
+	}
+	return nil
+}
+
+func (jw jsonWriter) indent(depth int) {
+	for i := 0; i < depth; i++ {
+		jw.w.WriteString("   ")
+	}
+}
+
+func (jw jsonWriter) string(s string) {
+	const hex = "0123456789ABCDEF"
+	jw.w.WriteByte('"')
+	for _, c := range s {
+		switch c {
+		case '\b':
+			jw.w.WriteString(`\b`)
+		case '\f':
+			jw.w.WriteString(`\f`)
+		case '\n':
+			jw.w.WriteString(`\n`)
+		case '\r':
+			jw.w.WriteString(`\r`)
+		case '\t':
+			jw.w.WriteString(`\t`)
+		case '\\':
+			jw.w.WriteString(`\\`)
+		case '"':
+			jw.w.WriteString(`\"`)
+		case '<':
+			jw.w.WriteString(`\u003C`) // to prevent script execution
+		case '\u2028':
+			jw.w.WriteString(`\u2028`)
+		case '\u2029':
+			jw.w.WriteString(`\u2029`)
+		default:
+			if c < 0x20 {
+				jw.w.WriteString(`\u00`)
+				jw.w.WriteByte(hex[c>>4])
+				jw.w.WriteByte(hex[c&0xF])
+			} else {
+				jw.w.WriteRune(c) // note: invalid utf-8 is replaced with U+FFFD like Chrome
+			}
+		}
+	}
+	jw.w.WriteByte('"')
+}
+
+// reformatJSON decodes buf and re-encodes it with writeJSON.
+func reformatJSON(w io.Writer, buf []byte, crlf bool) error {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(buf))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return err
+	}
+	return writeJSON(w, v, crlf)
+}
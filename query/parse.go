@@ -0,0 +1,349 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pgaskin/crb"
+)
+
+// Parse parses a query. An empty query matches everything.
+func Parse(s string) (Query, error) {
+	p := parser{toks: lex(s)}
+	q, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %s at %d", t, t.pos)
+	}
+	return q, nil
+}
+
+// MustParse is like Parse, but panics on error.
+func MustParse(s string) Query {
+	q, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokNeg
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind    tokenKind
+	pos     int
+	s       string // unquoted
+	colon   int    // the index of the first unquoted colon in s, or -1
+	tilde   int    // the index of the ~ after an unquoted name or url, or -1
+	quoted  bool   // if any part of the word was quoted
+	vquoted bool   // if any part of the word after the colon was quoted
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokNeg:
+		return "'-'"
+	case tokLParen:
+		return "'('"
+	case tokRParen:
+		return "')'"
+	default:
+		return fmt.Sprintf("%q", t.s)
+	}
+}
+
+func (t token) keyword(k string) bool {
+	return t.kind == tokWord && !t.quoted && t.s == k
+}
+
+func lex(s string) []token {
+	var toks []token
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '(':
+			toks = append(toks, token{kind: tokLParen, pos: i})
+			i++
+		case c == ')':
+			toks = append(toks, token{kind: tokRParen, pos: i})
+			i++
+		case c == '-' && i+1 < len(s) && !strings.ContainsRune(" \t\r\n)", rune(s[i+1])):
+			toks = append(toks, token{kind: tokNeg, pos: i})
+			i++
+		default:
+			t := token{kind: tokWord, pos: i, colon: -1, tilde: -1}
+			var b strings.Builder
+			var q bool
+		word:
+			for ; i < len(s); i++ {
+				c := s[i]
+				switch {
+				case q && c == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\'):
+					i++
+					b.WriteByte(s[i])
+				case q && c == '"':
+					q = false
+				case q:
+					b.WriteByte(c)
+				case c == '"':
+					q = true
+					t.quoted = true
+					if t.colon != -1 {
+						t.vquoted = true
+					}
+				case c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '(' || c == ')':
+					break word
+				case c == ':' && t.colon == -1 && t.tilde == -1 && !t.quoted:
+					t.colon = b.Len()
+					b.WriteByte(c)
+				case c == '~' && t.colon == -1 && t.tilde == -1 && !t.quoted && (b.String() == "name" || b.String() == "url"):
+					t.tilde = b.Len()
+					b.WriteByte(c)
+				default:
+					b.WriteByte(c)
+				}
+			}
+			t.s = b.String()
+			if t.colon == -1 {
+				t.vquoted = t.quoted
+			}
+			toks = append(toks, t)
+		}
+	}
+	return append(toks, token{kind: tokEOF, pos: len(s)})
+}
+
+type parser struct {
+	toks []token
+}
+
+func (p *parser) peek() token {
+	return p.toks[0]
+}
+
+func (p *parser) next() token {
+	t := p.toks[0]
+	if t.kind != tokEOF {
+		p.toks = p.toks[1:]
+	}
+	return t
+}
+
+func (p *parser) or() (Query, error) {
+	var qs []Query
+	for {
+		q, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		qs = append(qs, q)
+		if !p.peek().keyword("OR") {
+			break
+		}
+		p.next()
+	}
+	if len(qs) == 1 {
+		return qs[0], nil
+	}
+	return Or(qs...), nil
+}
+
+func (p *parser) and() (Query, error) {
+	var qs []Query
+	for {
+		t := p.peek()
+		if t.kind == tokEOF || t.kind == tokRParen || t.keyword("OR") {
+			break
+		}
+		if t.keyword("AND") {
+			p.next()
+			continue
+		}
+		q, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		qs = append(qs, q)
+	}
+	if len(qs) == 1 {
+		return qs[0], nil
+	}
+	return And(qs...), nil
+}
+
+func (p *parser) unary() (Query, error) {
+	switch t := p.next(); {
+	case t.kind == tokNeg || t.keyword("NOT"):
+		q, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return Not(q), nil
+	case t.kind == tokLParen:
+		q, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokRParen {
+			return nil, fmt.Errorf("expected ')' at %d, got %s", t.pos, t)
+		}
+		return q, nil
+	case t.kind == tokWord:
+		q, err := term(t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid term at %d: %w", t.pos, err)
+		}
+		return q, nil
+	default:
+		return nil, fmt.Errorf("unexpected %s at %d", t, t.pos)
+	}
+}
+
+func term(t token) (Query, error) {
+	if t.tilde != -1 {
+		r, err := regexp.Compile(t.s[t.tilde+1:])
+		if err != nil {
+			return nil, err
+		}
+		if t.s[:t.tilde] == "name" {
+			return NameRegexp(r), nil
+		}
+		return URLRegexp(r), nil
+	}
+	if t.colon == -1 {
+		return Text(t.s), nil
+	}
+	f, v := t.s[:t.colon], t.s[t.colon+1:]
+	re := func() (*regexp.Regexp, error) {
+		if t.vquoted || len(v) < 2 || v[0] != '/' || v[len(v)-1] != '/' {
+			return nil, nil
+		}
+		return regexp.Compile(v[1 : len(v)-1])
+	}
+	switch f {
+	case "name":
+		if r, err := re(); err != nil || r != nil {
+			if err != nil {
+				return nil, err
+			}
+			return NameRegexp(r), nil
+		}
+		return Name(v), nil
+	case "url":
+		if r, err := re(); err != nil || r != nil {
+			if err != nil {
+				return nil, err
+			}
+			return URLRegexp(r), nil
+		}
+		return URL(v), nil
+	case "host":
+		return Host(v)
+	case "path":
+		return URLPath(v)
+	case "in":
+		return In(v)
+	case "type":
+		switch t := crb.NodeType(v); t {
+		case crb.NodeTypeURL, crb.NodeTypeFolder:
+			return Type(t), nil
+		}
+		return nil, fmt.Errorf("unknown node type %q", v)
+	case string(DateAdded), string(DateModified), string(DateLastUsed):
+		from, to, err := parseDateRange(v)
+		if err != nil {
+			return nil, err
+		}
+		return dateRange{DateField(f), from, to, v}, nil
+	case "meta":
+		if k, x, ok := strings.Cut(v, "="); ok {
+			return Meta(k, &x), nil
+		}
+		return Meta(v, nil), nil
+	}
+	return Text(t.s), nil // not a field (e.g., a url)
+}
+
+// parseDateRange parses a date range in local time.
+func parseDateRange(v string) (from, to time.Time, err error) {
+	if a, b, ok := strings.Cut(v, ".."); ok {
+		if a != "" {
+			if from, _, err = parseDate(a); err != nil {
+				return
+			}
+		}
+		if b != "" {
+			if _, to, err = parseDate(b); err != nil {
+				return
+			}
+		}
+		if a == "" && b == "" {
+			err = fmt.Errorf("empty date range")
+		}
+		return
+	}
+	var op string
+	for _, x := range []string{">=", "<=", ">", "<"} {
+		if strings.HasPrefix(v, x) {
+			op, v = x, v[len(x):]
+			break
+		}
+	}
+	start, end, err := parseDate(v)
+	if err != nil {
+		return
+	}
+	switch op {
+	case ">":
+		return end, time.Time{}, nil
+	case ">=":
+		return start, time.Time{}, nil
+	case "<":
+		return time.Time{}, start, nil
+	case "<=":
+		return time.Time{}, end, nil
+	default:
+		return start, end, nil
+	}
+}
+
+// parseDate parses a year, month, day, or minute in local time, returning the
+// start and end of it. An RFC 3339 time is an instant, so the start and end are
+// the same.
+func parseDate(v string) (start, end time.Time, err error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, t, nil
+	}
+	for _, f := range []struct {
+		Layout string
+		Years  int
+		Months int
+		Days   int
+		Mins   int
+	}{
+		{"2006", 1, 0, 0, 0},
+		{"2006-01", 0, 1, 0, 0},
+		{"2006-01-02", 0, 0, 1, 0},
+		{"2006-01-02T15:04", 0, 0, 0, 1},
+	} {
+		if t, err := time.ParseInLocation(f.Layout, v, time.Local); err == nil {
+			return t, t.AddDate(f.Years, f.Months, f.Days).Add(time.Duration(f.Mins) * time.Minute), nil
+		}
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid date %q (expected yyyy, yyyy-mm, yyyy-mm-dd, yyyy-mm-ddThh:mm, or rfc3339)", v)
+}
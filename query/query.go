@@ -0,0 +1,407 @@
+// Package query searches Chrome bookmarks.
+//
+// # Syntax
+//
+// A query is a list of terms, which are implicitly combined with AND. Terms can
+// also be combined with AND, OR, and NOT (which must be uppercase), and grouped
+// with parentheses. A term prefixed with a dash is negated. Values containing
+// spaces or special characters can be quoted with double quotes, within which
+// \" and \\ are a literal quote and backslash.
+//
+// A bare term matches the name or URL of a node, ignoring case. Otherwise, a
+// term is a field and a value separated by a colon:
+//
+//	name:foo             name contains foo (ignoring case)
+//	name:/regexp/        name matches regexp
+//	name~"regexp"        name matches regexp (which may be quoted)
+//	url:foo              url contains foo (ignoring case)
+//	url:/regexp/         url matches regexp
+//	url~"regexp"         url matches regexp (which may be quoted)
+//	host:example.com     url host is example.com or a subdomain of it
+//	host:*.example.com   url host matches a path.Match pattern
+//	path:/foo            url path starts with /foo
+//	path:/foo/*          url path matches a path.Match pattern
+//	in:Work              node is within a folder named Work (a pattern)
+//	in:"Bookmarks bar/*" node is within a folder matching a crb path pattern
+//	type:url             node is a bookmark (or folder)
+//	added:2021           date added is within 2021 (also 2021-05, 2021-05-07, 2021-05-07T10:30, or RFC 3339)
+//	added:>=2021-05      date added is after the start of May 2021 (also >, <, <=)
+//	added:2020..2021-06  date added is within 2020 to June 2021 (either side is optional)
+//	modified:2021        date modified (same syntax as added)
+//	used:2021            date last used (same syntax as added)
+//	meta:key             node has meta_info key
+//	meta:key=value       node has meta_info key set to value
+//
+// A quoted value is never a regexp, and the /regexp/ form ends at a space,
+// parenthesis, or quote like any other unquoted value, so use the ~ form for
+// regexps containing them.
+//
+// For example, to find bookmarks within Work folders added in 2021 pointing to
+// Atlassian Cloud:
+//
+//	in:Work added:2021 host:*.atlassian.net
+package query
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pgaskin/crb"
+)
+
+// Node is a node being matched.
+type Node struct {
+	*crb.BookmarkNode
+	Path []string // the names of the node and its ancestors, including the permanent folder
+}
+
+// Query matches nodes.
+type Query interface {
+	Match(n Node) bool
+	String() string // the query in the syntax accepted by Parse
+}
+
+// Find returns the nodes in b matching q in tree order.
+func Find(b *crb.Bookmarks, q Query) []Node {
+	var ns []Node
+	for p, n := range b.All() {
+		x := Node{n, p}
+		if q.Match(x) {
+			x.Path = append([]string(nil), p...)
+			ns = append(ns, x)
+		}
+	}
+	return ns
+}
+
+type and []Query
+
+// And matches nodes matching all of q.
+func And(q ...Query) Query { return and(q) }
+
+func (q and) Match(n Node) bool {
+	for _, x := range q {
+		if !x.Match(n) {
+			return false
+		}
+	}
+	return true
+}
+
+func (q and) String() string {
+	s := make([]string, len(q))
+	for i, x := range q {
+		s[i] = x.String()
+		if _, ok := x.(or); ok {
+			s[i] = "(" + s[i] + ")"
+		}
+	}
+	return strings.Join(s, " ")
+}
+
+type or []Query
+
+// Or matches nodes matching any of q.
+func Or(q ...Query) Query { return or(q) }
+
+func (q or) Match(n Node) bool {
+	for _, x := range q {
+		if x.Match(n) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q or) String() string {
+	s := make([]string, len(q))
+	for i, x := range q {
+		s[i] = x.String()
+		if _, ok := x.(and); ok {
+			s[i] = "(" + s[i] + ")"
+		}
+	}
+	return strings.Join(s, " OR ")
+}
+
+type not struct{ q Query }
+
+// Not matches nodes not matching q.
+func Not(q Query) Query { return not{q} }
+
+func (q not) Match(n Node) bool {
+	return !q.q.Match(n)
+}
+
+func (q not) String() string {
+	switch q.q.(type) {
+	case and, or:
+		return "-(" + q.q.String() + ")"
+	}
+	return "-" + q.q.String()
+}
+
+type text struct {
+	field string
+	get   func(n Node) []string
+	s     string
+	re    *regexp.Regexp
+}
+
+// Text matches nodes where the name or URL contains s, ignoring case.
+func Text(s string) Query {
+	return text{"", func(n Node) []string { return []string{n.Name, n.URL} }, s, nil}
+}
+
+// Name matches nodes where the name contains s, ignoring case.
+func Name(s string) Query {
+	return text{"name", func(n Node) []string { return []string{n.Name} }, s, nil}
+}
+
+// NameRegexp matches nodes where the name matches re.
+func NameRegexp(re *regexp.Regexp) Query {
+	return text{"name", func(n Node) []string { return []string{n.Name} }, "", re}
+}
+
+// URL matches bookmarks where the URL contains s, ignoring case.
+func URL(s string) Query {
+	return text{"url", func(n Node) []string { return []string{n.URL} }, s, nil}
+}
+
+// URLRegexp matches bookmarks where the URL matches re.
+func URLRegexp(re *regexp.Regexp) Query {
+	return text{"url", func(n Node) []string { return []string{n.URL} }, "", re}
+}
+
+func (q text) Match(n Node) bool {
+	for _, v := range q.get(n) {
+		if q.re != nil {
+			if q.re.MatchString(v) {
+				return true
+			}
+		} else if v != "" && strings.Contains(strings.ToLower(v), strings.ToLower(q.s)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q text) String() string {
+	var v string
+	if q.re != nil {
+		// the /regexp/ form can't contain anything which ends a word
+		r := q.re.String()
+		if strings.ContainsAny(r, " \t\r\n\"()") {
+			return q.field + "~" + quote(r)
+		}
+		v = "/" + r + "/"
+	} else {
+		v = quote(q.s)
+	}
+	if q.field == "" {
+		return v
+	}
+	return q.field + ":" + v
+}
+
+type host string
+
+// Host matches bookmarks where the URL host is h or a subdomain of it, or if h
+// contains wildcards, where it matches the path.Match pattern h. The only
+// possible error is path.ErrBadPattern.
+func Host(h string) (Query, error) {
+	if _, err := path.Match(h, ""); err != nil {
+		return nil, err
+	}
+	return host(strings.ToLower(h)), nil
+}
+
+func (q host) Match(n Node) bool {
+	u, err := url.Parse(n.URL)
+	if err != nil || n.URL == "" {
+		return false
+	}
+	h := strings.ToLower(u.Hostname())
+	if hasMeta(string(q)) {
+		ok, _ := path.Match(string(q), h)
+		return ok
+	}
+	return h == string(q) || strings.HasSuffix(h, "."+string(q))
+}
+
+func (q host) String() string {
+	return "host:" + quote(string(q))
+}
+
+type urlPath string
+
+// URLPath matches bookmarks where the URL path starts with p, or if p contains
+// wildcards, where it matches the path.Match pattern p. The only possible error
+// is path.ErrBadPattern.
+func URLPath(p string) (Query, error) {
+	if _, err := path.Match(p, ""); err != nil {
+		return nil, err
+	}
+	return urlPath(p), nil
+}
+
+func (q urlPath) Match(n Node) bool {
+	u, err := url.Parse(n.URL)
+	if err != nil || n.URL == "" {
+		return false
+	}
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	if hasMeta(string(q)) {
+		ok, _ := path.Match(string(q), p)
+		return ok
+	}
+	return strings.HasPrefix(p, string(q))
+}
+
+func (q urlPath) String() string {
+	return "path:" + quote(string(q))
+}
+
+type in string
+
+// In matches nodes within a folder matching the crb path pattern p (see
+// crb.MatchPath). If p is a single path element, it matches nodes within a
+// folder with a matching name at any level. The only possible error is
+// path.ErrBadPattern.
+func In(p string) (Query, error) {
+	if _, err := crb.MatchPath(p, nil); err != nil {
+		return nil, err
+	}
+	return in(p), nil
+}
+
+func (q in) Match(n Node) bool {
+	if len(n.Path) == 0 {
+		return false
+	}
+	p := string(q)
+	if !strings.Contains(strings.ReplaceAll(p, `\/`, ""), "/") {
+		p = "**/" + p
+	}
+	for i := len(n.Path) - 1; i > 0; i-- {
+		if ok, _ := crb.MatchPath(p, n.Path[:i]); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (q in) String() string {
+	return "in:" + quote(string(q))
+}
+
+type nodeType crb.NodeType
+
+// Type matches nodes of type t.
+func Type(t crb.NodeType) Query {
+	return nodeType(t)
+}
+
+func (q nodeType) Match(n Node) bool {
+	return n.Type == crb.NodeType(q)
+}
+
+func (q nodeType) String() string {
+	return "type:" + string(q)
+}
+
+// DateField is a date of a node.
+type DateField string
+
+const (
+	DateAdded    DateField = "added"
+	DateModified DateField = "modified"
+	DateLastUsed DateField = "used"
+)
+
+func (f DateField) get(n Node) crb.Time {
+	switch f {
+	case DateAdded:
+		return n.DateAdded
+	case DateModified:
+		return n.DateModified
+	case DateLastUsed:
+		return n.DateLastUsed
+	}
+	return 0
+}
+
+type dateRange struct {
+	field    DateField
+	from, to time.Time
+	s        string
+}
+
+// DateRange matches nodes where the date is set and is within [from, to). If
+// from or to is zero, that side of the range is unbounded.
+func DateRange(field DateField, from, to time.Time) Query {
+	var s string
+	switch {
+	case from.IsZero():
+		s = "<" + to.Format(time.RFC3339Nano)
+	case to.IsZero():
+		s = ">=" + from.Format(time.RFC3339Nano)
+	default:
+		s = from.Format(time.RFC3339Nano) + ".." + to.Format(time.RFC3339Nano)
+	}
+	return dateRange{field, from, to, s}
+}
+
+func (q dateRange) Match(n Node) bool {
+	v := q.field.get(n)
+	if v.IsZero() {
+		return false
+	}
+	t := v.Time()
+	return (q.from.IsZero() || !t.Before(q.from)) && (q.to.IsZero() || t.Before(q.to))
+}
+
+func (q dateRange) String() string {
+	return string(q.field) + ":" + quote(q.s)
+}
+
+type meta struct {
+	key   string
+	value *string
+}
+
+// Meta matches nodes with meta_info key. If value is not nil, the value must
+// also match.
+func Meta(key string, value *string) Query {
+	return meta{key, value}
+}
+
+func (q meta) Match(n Node) bool {
+	v, ok := n.MetaInfo[q.key]
+	return ok && (q.value == nil || v == *q.value)
+}
+
+func (q meta) String() string {
+	if q.value == nil {
+		return "meta:" + quote(q.key)
+	}
+	return "meta:" + quote(q.key+"="+*q.value)
+}
+
+func hasMeta(s string) bool {
+	return strings.ContainsAny(s, `*?[\`)
+}
+
+// quote quotes s if necessary.
+func quote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\r\n\"():") && !strings.HasPrefix(s, "-") && !strings.HasPrefix(s, "/") && !strings.HasPrefix(s, "name~") && !strings.HasPrefix(s, "url~") && s != "AND" && s != "OR" && s != "NOT" {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
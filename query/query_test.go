@@ -0,0 +1,111 @@
+package query
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/pgaskin/crb"
+)
+
+func TestParseString(t *testing.T) {
+	var (
+		t0 = time.Date(2021, 5, 7, 10, 30, 15, 123456000, time.UTC)
+		t1 = time.Date(2022, 1, 1, 0, 0, 0, 0, time.FixedZone("", -5*60*60))
+		kv = "a:b"
+	)
+	for _, q := range []Query{
+		Text("foo"),
+		Text("foo:bar"),
+		Text("name:foo"),
+		Text("https://example.com/"),
+		Text("-foo"),
+		Text("OR"),
+		Name("a (b)"),
+		NameRegexp(regexp.MustCompile(`^a:b$`)),
+		NameRegexp(regexp.MustCompile(`^foo x?`)),
+		NameRegexp(regexp.MustCompile(`^(foo|bar)$`)),
+		URLRegexp(regexp.MustCompile(`:8080/"?$`)),
+		URLRegexp(regexp.MustCompile(`\.com`)),
+		Text("name~foo"),
+		Text("url~x"),
+		Name("~x"),
+		Text("example.com/~foo"),
+		URL("example.com:8080"),
+		DateRange(DateAdded, t0, t1),
+		DateRange(DateModified, t0, time.Time{}),
+		DateRange(DateLastUsed, time.Time{}, t1),
+		Meta("k:v", nil),
+		Meta("k", &kv),
+		And(Text("foo:bar"), Not(Or(Type(crb.NodeTypeURL), Name("x:y")))),
+	} {
+		s := q.String()
+		p, err := Parse(s)
+		if err != nil {
+			t.Errorf("parse %q: %v", s, err)
+			continue
+		}
+		if ps := p.String(); ps != s {
+			t.Errorf("parse %q: got %q", s, ps)
+		}
+
+		// ensure date ranges are parsed exactly and fields aren't confused
+		// with text
+		for i, v := range []time.Time{
+			t0.Add(-time.Microsecond),
+			t0,
+			t1.Add(-time.Microsecond),
+			t1,
+		} {
+			var n crb.Time
+			n.SetTime(v)
+			x := Node{BookmarkNode: &crb.BookmarkNode{
+				Type:         crb.NodeTypeURL,
+				Name:         []string{"foo", "x:y"}[i%2],
+				URL:          "https://example.com:8080/",
+				DateAdded:    n,
+				DateModified: n,
+				DateLastUsed: n,
+				MetaInfo:     map[string]string{"k": kv, "k:v": ""},
+			}}
+			if a, b := q.Match(x), p.Match(x); a != b {
+				t.Errorf("parse %q: match %s: got %t, expected %t", s, v, b, a)
+			}
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		in, out string
+	}{
+		{`name:/a/`, `name:/a/`},
+		{`name:"/a/"`, `name:"/a/"`},
+		{`name~a`, `name:/a/`},
+		{`name~"a b"`, `name~"a b"`},
+		{`url~"(x|y)"`, `url~"(x|y)"`},
+		{`url~"\"\\d"`, `url~"\"\\d"`},
+		{`(name~"a (b)" OR url~c)`, `name~"a (b)" OR url:/c/`},
+		{`-name~"a b"`, `-name~"a b"`},
+		{`name~^a:b$`, `name:/^a:b$/`},
+		{`"name~a"`, `"name~a"`},
+		{`host~a`, `host~a`},
+		{`example.com/~a:b`, `"example.com/~a:b"`},
+		{`url:~a`, `url:~a`},
+		{`name:/a b/`, `name:"/a" b/`}, // not a regexp
+	} {
+		q, err := Parse(tc.in)
+		if err != nil {
+			t.Errorf("parse %q: %v", tc.in, err)
+			continue
+		}
+		if s := q.String(); s != tc.out {
+			t.Errorf("parse %q: got %q, expected %q", tc.in, s, tc.out)
+		}
+	}
+	for _, s := range []string{`name~"("`, `url~[`} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("parse %q: expected error", s)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// Package urlnorm normalizes bookmark URLs for comparison and cleanup.
+//
+// Only hierarchical URLs with a host (e.g., http://example.com/) are changed,
+// except for lowercasing the scheme. The parts of the URL which aren't
+// affected by a rule are left as-is (i.e., they aren't re-escaped).
+package urlnorm
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Rules is a set of normalization rules.
+type Rules uint
+
+const (
+	Scheme        Rules = 1 << iota // lowercase the scheme
+	Host                            // lowercase the host
+	Port                            // remove default ports (e.g., :443 for https)
+	EmptyPath                       // add a slash if the path is empty (e.g., http://example.com)
+	TrailingSlash                   // remove the trailing slash from non-root paths
+	SortQuery                       // sort the query parameters by name (stable)
+	Tracking                        // remove tracking query parameters (e.g., utm_*, fbclid, gclid)
+	Fragment                        // remove the fragment
+
+	// Default is the set of rules which don't change the meaning of a URL.
+	Default = Scheme | Host | Port | EmptyPath
+
+	// All is the set of all rules.
+	All = Scheme | Host | Port | EmptyPath | TrailingSlash | SortQuery | Tracking | Fragment
+)
+
+var ruleNames = []struct {
+	Name string
+	Rule Rules
+}{
+	{"scheme", Scheme},
+	{"host", Host},
+	{"port", Port},
+	{"empty-path", EmptyPath},
+	{"trailing-slash", TrailingSlash},
+	{"sort-query", SortQuery},
+	{"tracking", Tracking},
+	{"fragment", Fragment},
+	{"default", Default},
+	{"all", All},
+}
+
+// RuleNames returns the names of the rules accepted by ParseRules.
+func RuleNames() []string {
+	n := make([]string, len(ruleNames))
+	for i, r := range ruleNames {
+		n[i] = r.Name
+	}
+	return n
+}
+
+// ParseRules parses a comma-separated list of rule names (see RuleNames). A
+// name prefixed with a dash removes the rule (e.g., "all,-fragment").
+func ParseRules(s string) (Rules, error) {
+	var r Rules
+	for _, x := range strings.Split(s, ",") {
+		x = strings.TrimSpace(x)
+		if x == "" {
+			continue
+		}
+		neg := strings.HasPrefix(x, "-")
+		if neg {
+			x = x[1:]
+		}
+		var ok bool
+		for _, n := range ruleNames {
+			if n.Name == x {
+				if neg {
+					r &^= n.Rule
+				} else {
+					r |= n.Rule
+				}
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return 0, fmt.Errorf("unknown rule %q", x)
+		}
+	}
+	return r, nil
+}
+
+// String returns the names of the rules in r.
+func (r Rules) String() string {
+	var s []string
+	for _, n := range ruleNames {
+		if n.Rule&(n.Rule-1) == 0 && r&n.Rule != 0 {
+			s = append(s, n.Name)
+			r &^= n.Rule
+		}
+	}
+	if r != 0 {
+		s = append(s, fmt.Sprintf("0x%x", uint(r)))
+	}
+	return strings.Join(s, ",")
+}
+
+// defaultPorts are the default ports for schemes.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ws":    "80",
+	"wss":   "443",
+	"ftp":   "21",
+}
+
+// trackingParams are query parameters used only for tracking. Parameters
+// starting with utm_ are also removed.
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"gclsrc":  true,
+	"msclkid": true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"igshid":  true,
+	"yclid":   true,
+	"_ga":     true,
+}
+
+// Normalize applies r to u. If u can't be parsed or isn't changed by r, it is
+// returned as-is.
+func (r Rules) Normalize(u string) string {
+	x, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+
+	// split the original string so the unchanged parts are kept as-is
+	var scheme, rest, query, frag string
+	if x.Scheme != "" {
+		if len(u) <= len(x.Scheme) || u[len(x.Scheme)] != ':' {
+			return u
+		}
+		scheme, rest = u[:len(x.Scheme)+1], u[len(x.Scheme)+1:]
+	} else {
+		rest = u
+	}
+	if i := strings.IndexByte(rest, '#'); i != -1 {
+		rest, frag = rest[:i], rest[i:]
+	}
+	if i := strings.IndexByte(rest, '?'); i != -1 {
+		rest, query = rest[:i], rest[i:]
+	}
+
+	if r&Scheme != 0 {
+		scheme = strings.ToLower(scheme)
+	}
+	if x.Opaque == "" && x.Host != "" && strings.HasPrefix(rest, "//") {
+		host, path := rest[2:], ""
+		if i := strings.IndexByte(host, '/'); i != -1 {
+			host, path = host[:i], host[i:]
+		}
+		var user string
+		if i := strings.LastIndexByte(host, '@'); i != -1 {
+			user, host = host[:i+1], host[i+1:]
+		}
+		if r&Host != 0 {
+			host = strings.ToLower(host)
+		}
+		if r&Port != 0 {
+			if p := x.Port(); p != "" && p == defaultPorts[strings.ToLower(x.Scheme)] {
+				host = strings.TrimSuffix(host, ":"+p)
+			}
+		}
+		if r&EmptyPath != 0 && path == "" {
+			path = "/"
+		}
+		if r&TrailingSlash != 0 && len(path) > 1 && strings.HasSuffix(path, "/") {
+			if path = strings.TrimRight(path, "/"); path == "" {
+				path = "/"
+			}
+		}
+		if r&(SortQuery|Tracking) != 0 && len(query) > 1 {
+			ps := strings.Split(query[1:], "&")
+			if r&Tracking != 0 {
+				q := ps[:0]
+				for _, p := range ps {
+					if k := queryKey(p); !trackingParams[k] && !strings.HasPrefix(k, "utm_") {
+						q = append(q, p)
+					}
+				}
+				ps = q
+			}
+			if r&SortQuery != 0 {
+				sort.SliceStable(ps, func(i, j int) bool {
+					return queryKey(ps[i]) < queryKey(ps[j])
+				})
+			}
+			if query = ""; len(ps) != 0 {
+				query = "?" + strings.Join(ps, "&")
+			}
+		}
+		if r&Fragment != 0 {
+			frag = ""
+		}
+		rest = "//" + user + host + path
+	}
+	return scheme + rest + query + frag
+}
+
+// queryKey returns the unescaped name of a query parameter.
+func queryKey(p string) string {
+	k, _, _ := strings.Cut(p, "=")
+	if v, err := url.QueryUnescape(k); err == nil {
+		return v
+	}
+	return k
+}